@@ -0,0 +1,128 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrMalformed is returned when a line is not a valid JSON envelope.
+	ErrMalformed = errors.New("malformed message")
+	// ErrUnknownType is returned when no payload is registered for the type.
+	ErrUnknownType = errors.New("unknown message type")
+	// ErrInvalidPayload is returned when data does not match the payload type.
+	ErrInvalidPayload = errors.New("invalid payload")
+)
+
+// Envelope is the wire form of a Message with the payload left undecoded.
+type Envelope struct {
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	Timestamp time.Time       `json:"ts,omitzero"`
+	Seq       uint64          `json:"seq,omitempty"`
+	ID        string          `json:"id,omitempty"`
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]func() interface{})
+)
+
+// Register associates a message type with a constructor returning a pointer
+// to a fresh payload struct. Registering a type again replaces it.
+func Register(msgType string, newPayload func() interface{}) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[msgType] = newPayload
+}
+
+// NewPayload returns an empty payload for the type, if it is registered.
+func NewPayload(msgType string) (interface{}, bool) {
+	registryMu.RLock()
+	newPayload, ok := registry[msgType]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	return newPayload(), true
+}
+
+// Decode parses one line of the protocol. On success Message.Data holds a
+// pointer to the registered payload struct (e.g. *CpuUsageData). For unknown
+// types the envelope fields are still filled, Data holds the raw JSON and the
+// error wraps ErrUnknownType.
+func Decode(line []byte) (Message, error) {
+	var env Envelope
+	if err := json.Unmarshal(line, &env); err != nil {
+		return Message{}, fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	if env.Type == "" {
+		return Message{}, fmt.Errorf("%w: missing type", ErrMalformed)
+	}
+
+	msg := Message{
+		Type:      env.Type,
+		Data:      env.Data,
+		Timestamp: env.Timestamp,
+		Seq:       env.Seq,
+		ID:        env.ID,
+	}
+
+	payload, ok := NewPayload(env.Type)
+	if !ok {
+		return msg, fmt.Errorf("%w %q", ErrUnknownType, env.Type)
+	}
+
+	if len(env.Data) > 0 && !bytes.Equal(env.Data, []byte("null")) {
+		if err := json.Unmarshal(env.Data, payload); err != nil {
+			return msg, fmt.Errorf("%w for %s: %v", ErrInvalidPayload, env.Type, err)
+		}
+	}
+
+	msg.Data = payload
+	return msg, nil
+}
+
+// Encode serializes a message as a protocol line terminated by '\n'.
+func Encode(msg Message) ([]byte, error) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return append(payload, '\n'), nil
+}
+
+func init() {
+	Register("handshake", func() interface{} { return &HandshakeData{} })
+	Register("handshake_ack", func() interface{} { return &HandshakeAckData{} })
+	Register("handshake_error", func() interface{} { return &HandshakeErrorData{} })
+	Register("error", func() interface{} { return &ErrorData{} })
+	Register("ping", func() interface{} { return &HeartbeatData{} })
+	Register("pong", func() interface{} { return &HeartbeatData{} })
+	Register("server_shutdown", func() interface{} { return &ServerShutdownData{} })
+	Register("cpu_usage", func() interface{} { return &CpuUsageData{} })
+	Register("memory_usage", func() interface{} { return &MemoryUsageData{} })
+	Register("disk_usage", func() interface{} { return &DiskUsageData{} })
+	Register("disk_io", func() interface{} { return &DiskIOData{} })
+	Register("general_data", func() interface{} { return &GeneralData{} })
+	Register("system_load", func() interface{} { return &SystemLoadData{} })
+	Register("process_usage", func() interface{} { return &ProcessUsageData{} })
+	Register("network_usage", func() interface{} { return &NetworkUsageData{} })
+	Register("interval_update", func() interface{} { return &IntervalUpdateData{} })
+	Register("samples_replay", func() interface{} { return &SamplesReplayData{} })
+	Register("set_interval", func() interface{} { return &IntervalUpdateData{} })
+	Register("clients_request", func() interface{} { return &ClientsRequestData{} })
+	Register("clients_state", func() interface{} { return &ClientsStateData{} })
+	Register("client_update", func() interface{} { return &ClientUpdateData{} })
+	Register("client_removed", func() interface{} { return &ClientRemovedData{} })
+	Register("interval_set_request", func() interface{} { return &IntervalUpdateData{} })
+	Register("history_request", func() interface{} { return &HistoryRequestData{} })
+	Register("history_response", func() interface{} { return &HistoryResponseData{} })
+	Register("alert", func() interface{} { return &AlertData{} })
+	Register("alerts_state", func() interface{} { return &AlertsStateData{} })
+	Register("alert_ack", func() interface{} { return &AlertAckData{} })
+}
@@ -0,0 +1,134 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 123000000, time.UTC)
+	tests := []struct {
+		name string
+		msg  Message
+	}{
+		{"cpu usage", Message{Type: "cpu_usage", Data: &CpuUsageData{Usage: 42.5, CoresUsage: []float64{40, 45}}, Timestamp: ts, Seq: 7}},
+		{"handshake", Message{Type: "handshake", Data: &HandshakeData{ClientID: "agent", Version: ProtocolVersion, Role: "client", Features: []string{FeatureHeartbeat}}, ID: "m-1"}},
+		{"disk usage with mounts", Message{Type: "disk_usage", Data: &DiskUsageData{Total: 100, Used: 40, Free: 60, UsedPercent: 40, Mounts: []MountUsage{{Mountpoint: "/", Device: "/dev/sda1", Fstype: "ext4", Total: 100}}}}},
+		{"general data", Message{Type: "general_data", Data: &GeneralData{ModelName: "cpu", Cores: 4, LogicalCores: 8, Hostname: "box", BootTime: ts}}},
+		{"system load", Message{Type: "system_load", Data: &SystemLoadData{Load1: 0.5, Load5: 0.25, Load15: 0.1, ProcsRunning: 2}}},
+		{"no payload", Message{Type: "clients_request", Data: &ClientsRequestData{}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line, err := Encode(tt.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasSuffix(line, []byte("\n")) || bytes.Count(line, []byte("\n")) != 1 {
+				t.Fatalf("encoded line must end with a single newline: %q", line)
+			}
+
+			got, err := Decode(line)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if got.Type != tt.msg.Type || got.Seq != tt.msg.Seq || got.ID != tt.msg.ID || !got.Timestamp.Equal(tt.msg.Timestamp) {
+				t.Fatalf("envelope = %+v, want %+v", got, tt.msg)
+			}
+			if reflect.TypeOf(got.Data) != reflect.TypeOf(tt.msg.Data) {
+				t.Fatalf("payload type = %T, want %T", got.Data, tt.msg.Data)
+			}
+			if !reflect.DeepEqual(got.Data, tt.msg.Data) {
+				t.Fatalf("payload = %+v, want %+v", got.Data, tt.msg.Data)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want error
+	}{
+		{"not json", `{"type":`, ErrMalformed},
+		{"not an object", `[1,2]`, ErrMalformed},
+		{"missing type", `{"data":{}}`, ErrMalformed},
+		{"unknown type", `{"type":"teleport","data":{"to":"mars"}}`, ErrUnknownType},
+		{"payload of wrong shape", `{"type":"cpu_usage","data":{"usage":"high"}}`, ErrInvalidPayload},
+		{"payload not an object", `{"type":"memory_usage","data":[1]}`, ErrInvalidPayload},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode([]byte(tt.line))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Decode(%s) error = %v, want %v", tt.line, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeUnknownTypeKeepsEnvelope(t *testing.T) {
+	msg, err := Decode([]byte(`{"type":"teleport","data":{"to":"mars"},"seq":3,"id":"x"}`))
+	if !errors.Is(err, ErrUnknownType) {
+		t.Fatalf("error = %v, want ErrUnknownType", err)
+	}
+	if msg.Type != "teleport" || msg.Seq != 3 || msg.ID != "x" {
+		t.Fatalf("envelope not kept: %+v", msg)
+	}
+	raw, ok := msg.Data.(json.RawMessage)
+	if !ok || string(raw) != `{"to":"mars"}` {
+		t.Fatalf("Data = %#v, want the raw payload", msg.Data)
+	}
+}
+
+func TestDecodeNullPayload(t *testing.T) {
+	for _, line := range []string{`{"type":"clients_request"}`, `{"type":"clients_request","data":null}`} {
+		msg, err := Decode([]byte(line))
+		if err != nil {
+			t.Fatalf("Decode(%s): %v", line, err)
+		}
+		if _, ok := msg.Data.(*ClientsRequestData); !ok {
+			t.Fatalf("Decode(%s) Data = %T, want *ClientsRequestData", line, msg.Data)
+		}
+	}
+}
+
+func TestRegisterAndNewPayload(t *testing.T) {
+	type custom struct {
+		Value int `json:"value"`
+	}
+	if _, ok := NewPayload("test_custom"); ok {
+		t.Fatal("test_custom registered before Register")
+	}
+
+	Register("test_custom", func() interface{} { return &custom{} })
+	defer func() {
+		registryMu.Lock()
+		delete(registry, "test_custom")
+		registryMu.Unlock()
+	}()
+
+	first, ok := NewPayload("test_custom")
+	if !ok {
+		t.Fatal("test_custom not registered")
+	}
+	second, _ := NewPayload("test_custom")
+	if first == second {
+		t.Fatal("NewPayload must return a fresh payload every time")
+	}
+
+	msg, err := Decode([]byte(`{"type":"test_custom","data":{"value":9}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := msg.Data.(*custom); got.Value != 9 {
+		t.Fatalf("value = %d, want 9", got.Value)
+	}
+}
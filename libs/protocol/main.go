@@ -1,16 +1,24 @@
 package protocol
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Message struct {
-	Type string      `json:"type"`
-	Data interface{} `json:"data"`
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data"`
+	Timestamp time.Time   `json:"ts,omitzero"`
+	Seq       uint64      `json:"seq,omitempty"`
+	ID        string      `json:"id,omitempty"`
 }
 
 type HandshakeData struct {
-	ClientID string `json:"client_id"`
-	Version  string `json:"version"`
-	Role     string `json:"role"`
+	ClientID string   `json:"client_id"`
+	Version  string   `json:"version"`
+	Role     string   `json:"role"`
+	Token    string   `json:"token,omitempty"`
+	Features []string `json:"features,omitempty"`
 }
 
 type CpuUsageData struct {
@@ -25,16 +33,64 @@ type MemoryUsageData struct {
 }
 
 type DiskUsageData struct {
-	Total       uint64  `json:"total"`
-	Used        uint64  `json:"used"`
-	Free        uint64  `json:"free"`
-	UsedPercent float64 `json:"used_percent"`
+	Total       uint64       `json:"total"`
+	Used        uint64       `json:"used"`
+	Free        uint64       `json:"free"`
+	UsedPercent float64      `json:"used_percent"`
+	Mounts      []MountUsage `json:"mounts,omitempty"`
+}
+
+type MountUsage struct {
+	Mountpoint        string  `json:"mountpoint"`
+	Device            string  `json:"device"`
+	Fstype            string  `json:"fstype"`
+	Total             uint64  `json:"total"`
+	Used              uint64  `json:"used"`
+	Free              uint64  `json:"free"`
+	UsedPercent       float64 `json:"used_percent"`
+	InodesTotal       uint64  `json:"inodes_total"`
+	InodesUsed        uint64  `json:"inodes_used"`
+	InodesUsedPercent float64 `json:"inodes_used_percent"`
+}
+
+type DiskIOData struct {
+	Devices []DiskDeviceIO `json:"devices"`
+}
+
+type DiskDeviceIO struct {
+	Name             string  `json:"name"`
+	ReadsPerSec      float64 `json:"reads_per_sec"`
+	WritesPerSec     float64 `json:"writes_per_sec"`
+	ReadBytesPerSec  float64 `json:"read_bytes_per_sec"`
+	WriteBytesPerSec float64 `json:"write_bytes_per_sec"`
+	BusyPercent      float64 `json:"busy_percent"`
 }
 
 type GeneralData struct {
-	ModelName string  `json:"model_name"`
-	Cores     int32   `json:"cores"`
-	Mhz       float64 `json:"mhz"`
+	ModelName       string    `json:"model_name"`
+	Cores           int32     `json:"cores"`
+	Mhz             float64   `json:"mhz"`
+	LogicalCores    int       `json:"logical_cores,omitempty"`
+	PhysicalCores   int       `json:"physical_cores,omitempty"`
+	Hostname        string    `json:"hostname,omitempty"`
+	OS              string    `json:"os,omitempty"`
+	Platform        string    `json:"platform,omitempty"`
+	PlatformVersion string    `json:"platform_version,omitempty"`
+	KernelVersion   string    `json:"kernel_version,omitempty"`
+	KernelArch      string    `json:"kernel_arch,omitempty"`
+	BootTime        time.Time `json:"boot_time,omitzero"`
+}
+
+type SystemLoadData struct {
+	Load1                 float64 `json:"load1"`
+	Load5                 float64 `json:"load5"`
+	Load15                float64 `json:"load15"`
+	SwapTotal             uint64  `json:"swap_total"`
+	SwapUsed              uint64  `json:"swap_used"`
+	SwapUsedPercent       float64 `json:"swap_used_percent"`
+	ContextSwitchesPerSec float64 `json:"context_switches_per_sec"`
+	ProcsRunning          int     `json:"procs_running"`
+	ProcsBlocked          int     `json:"procs_blocked"`
 }
 
 type ProcessUsageData struct {
@@ -49,6 +105,22 @@ type ProcessInfo struct {
 	MemoryPercent float32 `json:"memory_percent"`
 }
 
+type NetworkUsageData struct {
+	Interfaces []NetworkInterfaceUsage `json:"interfaces"`
+}
+
+type NetworkInterfaceUsage struct {
+	Name             string  `json:"name"`
+	BytesInPerSec    float64 `json:"bytes_in_per_sec"`
+	BytesOutPerSec   float64 `json:"bytes_out_per_sec"`
+	PacketsInPerSec  float64 `json:"packets_in_per_sec"`
+	PacketsOutPerSec float64 `json:"packets_out_per_sec"`
+	ErrorsInPerSec   float64 `json:"errors_in_per_sec"`
+	ErrorsOutPerSec  float64 `json:"errors_out_per_sec"`
+	DropsInPerSec    float64 `json:"drops_in_per_sec"`
+	DropsOutPerSec   float64 `json:"drops_out_per_sec"`
+}
+
 type ClientsRequestData struct{}
 
 type ClientStateSummary struct {
@@ -57,10 +129,30 @@ type ClientStateSummary struct {
 	CPU             *CpuUsageData     `json:"cpu,omitempty"`
 	Memory          *MemoryUsageData  `json:"memory,omitempty"`
 	Disk            *DiskUsageData    `json:"disk,omitempty"`
+	DiskIO          *DiskIOData       `json:"disk_io,omitempty"`
 	General         *GeneralData      `json:"general,omitempty"`
+	Load            *SystemLoadData   `json:"load,omitempty"`
 	Processes       *ProcessUsageData `json:"processes,omitempty"`
+	Network         *NetworkUsageData `json:"network,omitempty"`
 	LastUpdate      time.Time         `json:"last_update"`
 	StatsIntervalMs int64             `json:"stats_interval_ms,omitempty"`
+	Sequence        *SequenceStats    `json:"sequence,omitempty"`
+	Health          string            `json:"health,omitempty"`
+}
+
+// Client health levels reported in ClientStateSummary.Health, derived from how
+// long ago the last update arrived compared to the client's interval.
+const (
+	HealthHealthy = "healthy"
+	HealthLate    = "late"
+	HealthStale   = "stale"
+)
+
+type SequenceStats struct {
+	LastSeq    uint64 `json:"last_seq"`
+	Received   uint64 `json:"received"`
+	Missing    uint64 `json:"missing"`
+	Duplicates uint64 `json:"duplicates"`
 }
 
 type ClientsStateData struct {
@@ -80,3 +172,96 @@ type IntervalUpdateData struct {
 	ClientID   string `json:"client_id,omitempty"`
 	IntervalMs int64  `json:"interval_ms"`
 }
+
+type HistoryRequestData struct {
+	ClientID    string    `json:"client_id"`
+	Metric      string    `json:"metric"`
+	Field       string    `json:"field,omitempty"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	StepMs      int64     `json:"step_ms"`
+	Aggregation string    `json:"aggregation,omitempty"`
+}
+
+type HistoryPoint struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+type HistoryResponseData struct {
+	ClientID    string         `json:"client_id"`
+	Metric      string         `json:"metric"`
+	Field       string         `json:"field"`
+	From        time.Time      `json:"from"`
+	To          time.Time      `json:"to"`
+	StepMs      int64          `json:"step_ms"`
+	Aggregation string         `json:"aggregation"`
+	Points      []HistoryPoint `json:"points"`
+	Error       string         `json:"error,omitempty"`
+}
+
+type AlertData struct {
+	ID         string    `json:"id"`
+	Rule       string    `json:"rule"`
+	ClientID   string    `json:"client_id"`
+	Metric     string    `json:"metric"`
+	Field      string    `json:"field"`
+	Operator   string    `json:"operator"`
+	Threshold  float64   `json:"threshold"`
+	Value      float64   `json:"value"`
+	Severity   string    `json:"severity"`
+	State      string    `json:"state"`
+	Message    string    `json:"message,omitempty"`
+	StartsAt   time.Time `json:"starts_at"`
+	FiredAt    time.Time `json:"fired_at,omitzero"`
+	ResolvedAt time.Time `json:"resolved_at,omitzero"`
+	AckedBy    string    `json:"acked_by,omitempty"`
+	AckedAt    time.Time `json:"acked_at,omitzero"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type AlertsStateData struct {
+	Alerts []AlertData `json:"alerts"`
+}
+
+type AlertAckData struct {
+	AlertID string `json:"alert_id"`
+}
+
+type BufferedSample struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type SamplesReplayData struct {
+	Samples []BufferedSample `json:"samples"`
+}
+
+// Codes carried by ErrorData.
+const (
+	ErrorMalformed         = "malformed"
+	ErrorUnknownType       = "unknown_type"
+	ErrorInvalidPayload    = "invalid_payload"
+	ErrorHandshakeRequired = "handshake_required"
+	ErrorForbidden         = "forbidden"
+	ErrorInvalidRequest    = "invalid_request"
+	ErrorNotFound          = "not_found"
+	ErrorConflict          = "conflict"
+	ErrorInternal          = "internal"
+)
+
+type ServerShutdownData struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+type HeartbeatData struct {
+	SentAt time.Time `json:"sent_at"`
+}
+
+type ErrorData struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	RefID   string `json:"ref_id,omitempty"`
+	RefType string `json:"ref_type,omitempty"`
+}
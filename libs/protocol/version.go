@@ -0,0 +1,107 @@
+package protocol
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ProtocolVersion is the version spoken by this build. Peers with the same
+// major version are compatible; minor versions only add optional features.
+const ProtocolVersion = "1.5.0"
+
+// LegacyVersion is assumed for peers that send no version and for servers
+// that do not answer the handshake with handshake_ack.
+const LegacyVersion = "1.0.0"
+
+// Optional features announced in handshake and handshake_ack.
+const (
+	FeatureHistory       = "history"
+	FeatureAlerts        = "alerts"
+	FeatureSamplesReplay = "samples_replay"
+	FeatureHeartbeat     = "heartbeat"
+)
+
+type HandshakeAckData struct {
+	Version     string   `json:"version"`
+	Features    []string `json:"features,omitempty"`
+	ClientID    string   `json:"client_id,omitempty"`
+	HeartbeatMs int64    `json:"heartbeat_ms,omitempty"`
+}
+
+type HandshakeErrorData struct {
+	Reason  string `json:"reason"`
+	Version string `json:"version"`
+}
+
+// Supports reports whether the server announced the feature.
+func (a HandshakeAckData) Supports(feature string) bool {
+	return slices.Contains(a.Features, feature)
+}
+
+// AtLeast reports whether the negotiated version is min or newer. Message
+// types added in later minor versions must only be sent when it holds.
+func (a HandshakeAckData) AtLeast(min string) bool {
+	version := a.Version
+	if version == "" {
+		version = LegacyVersion
+	}
+	major, minor, patch, err := ParseVersion(version)
+	if err != nil {
+		return false
+	}
+	wantMajor, wantMinor, wantPatch, err := ParseVersion(min)
+	if err != nil {
+		return false
+	}
+	if major != wantMajor {
+		return major > wantMajor
+	}
+	if minor != wantMinor {
+		return minor > wantMinor
+	}
+	return patch >= wantPatch
+}
+
+// ParseVersion splits a "major.minor.patch" version. Missing minor or patch
+// parts are read as zero.
+func ParseVersion(version string) (major, minor, patch int, err error) {
+	parts := strings.Split(version, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return 0, 0, 0, fmt.Errorf("invalid version %q", version)
+	}
+
+	nums := make([]int, 3)
+	for i, part := range parts {
+		n, convErr := strconv.Atoi(part)
+		if convErr != nil || n < 0 {
+			return 0, 0, 0, fmt.Errorf("invalid version %q", version)
+		}
+		nums[i] = n
+	}
+	return nums[0], nums[1], nums[2], nil
+}
+
+// NegotiateVersion returns the version both sides speak: the lower of the
+// peer's and ours, as long as the major versions match. An empty peer
+// version is treated as LegacyVersion.
+func NegotiateVersion(peer string) (string, error) {
+	if peer == "" {
+		peer = LegacyVersion
+	}
+
+	peerMajor, peerMinor, peerPatch, err := ParseVersion(peer)
+	if err != nil {
+		return "", err
+	}
+	major, minor, patch, _ := ParseVersion(ProtocolVersion)
+
+	if peerMajor != major {
+		return "", fmt.Errorf("incompatible protocol version %s (server speaks %s)", peer, ProtocolVersion)
+	}
+	if peerMinor < minor || (peerMinor == minor && peerPatch < patch) {
+		return fmt.Sprintf("%d.%d.%d", peerMajor, peerMinor, peerPatch), nil
+	}
+	return ProtocolVersion, nil
+}
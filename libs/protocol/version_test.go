@@ -0,0 +1,46 @@
+package protocol
+
+import "testing"
+
+func TestHandshakeAckAtLeast(t *testing.T) {
+	tests := []struct {
+		negotiated, min string
+		want            bool
+	}{
+		{"1.5.0", "1.5.0", true},
+		{"1.5.0", "1.3.0", true},
+		{"1.4.2", "1.5.0", false},
+		{"1.4.2", "1.4.1", true},
+		{"1.4", "1.4.0", true},
+		{"2.0.0", "1.9.0", true},
+		{"", "1.0.0", true},
+		{"", "1.3.0", false},
+		{"garbage", "1.0.0", false},
+	}
+	for _, tt := range tests {
+		ack := HandshakeAckData{Version: tt.negotiated}
+		if got := ack.AtLeast(tt.min); got != tt.want {
+			t.Errorf("AtLeast(%q) with version %q = %v, want %v", tt.min, tt.negotiated, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiateVersion(t *testing.T) {
+	tests := []struct {
+		peer, want string
+		wantErr    bool
+	}{
+		{"", LegacyVersion, false},
+		{"1.2.0", "1.2.0", false},
+		{ProtocolVersion, ProtocolVersion, false},
+		{"1.99.0", ProtocolVersion, false},
+		{"2.0.0", "", true},
+		{"x.y", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NegotiateVersion(tt.peer)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NegotiateVersion(%q) = %q, %v; want %q (error %v)", tt.peer, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
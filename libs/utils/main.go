@@ -2,6 +2,10 @@ package utils
 
 import "encoding/json"
 
+// ParseData converts a generic decoded value into out by re-serializing it.
+//
+// Deprecated: decode messages with protocol.Decode, which fills the typed
+// payload directly.
 func ParseData(input interface{}, out interface{}) error {
 	bytes, err := json.Marshal(input)
 	if err != nil {
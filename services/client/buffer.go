@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"libs/protocol"
+	"os"
+	"sync"
+	"time"
+)
+
+const replayBatchSize = 100
+
+// offlineBuffer keeps the samples produced while the agent is disconnected.
+// The most recent ones live in a fixed-size ring; when it overflows the oldest
+// samples move to an optional on-disk spool instead of being dropped.
+type offlineBuffer struct {
+	mu        sync.Mutex
+	ring      []protocol.BufferedSample
+	head      int
+	count     int
+	spoolPath string
+	spoolMax  int64
+	spoolSize int64
+	dropped   int
+}
+
+func newOfflineBuffer(capacity int, spoolPath string, spoolMax int64) *offlineBuffer {
+	if capacity <= 0 {
+		capacity = 1
+	}
+	b := &offlineBuffer{
+		ring:      make([]protocol.BufferedSample, capacity),
+		spoolPath: spoolPath,
+		spoolMax:  spoolMax,
+	}
+	if spoolPath != "" {
+		if info, err := os.Stat(spoolPath); err == nil {
+			b.spoolSize = info.Size()
+		}
+	}
+	return b
+}
+
+// add stores a sample, pushing the oldest one to the spool when the ring is full.
+func (b *offlineBuffer) add(sample protocol.BufferedSample) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pushLocked(sample)
+}
+
+func (b *offlineBuffer) pushLocked(sample protocol.BufferedSample) {
+	capacity := len(b.ring)
+	if b.count < capacity {
+		b.ring[(b.head+b.count)%capacity] = sample
+		b.count++
+		return
+	}
+
+	b.spoolLocked(b.ring[b.head])
+	b.ring[b.head] = sample
+	b.head = (b.head + 1) % capacity
+}
+
+func (b *offlineBuffer) spoolLocked(sample protocol.BufferedSample) {
+	if b.spoolPath == "" {
+		b.dropped++
+		return
+	}
+
+	line, err := json.Marshal(sample)
+	if err != nil {
+		b.dropped++
+		return
+	}
+	line = append(line, '\n')
+	if b.spoolMax > 0 && b.spoolSize+int64(len(line)) > b.spoolMax {
+		b.dropped++
+		return
+	}
+
+	f, err := os.OpenFile(b.spoolPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		b.dropped++
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(line); err != nil {
+		b.dropped++
+		return
+	}
+	b.spoolSize += int64(len(line))
+}
+
+// drain removes and returns every buffered sample, spooled ones first.
+func (b *offlineBuffer) drain() []protocol.BufferedSample {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var samples []protocol.BufferedSample
+	if b.spoolPath != "" && b.spoolSize > 0 {
+		spooled, err := readSpool(b.spoolPath)
+		if err != nil {
+			fmt.Println("❌ Error reading spool:", err)
+		} else {
+			samples = spooled
+			if err := os.Truncate(b.spoolPath, 0); err != nil {
+				fmt.Println("❌ Error truncating spool:", err)
+			}
+			b.spoolSize = 0
+		}
+	}
+
+	for i := 0; i < b.count; i++ {
+		samples = append(samples, b.ring[(b.head+i)%len(b.ring)])
+	}
+	b.head, b.count = 0, 0
+
+	return samples
+}
+
+// restore puts back samples that could not be replayed, ahead of anything
+// buffered in the meantime.
+func (b *offlineBuffer) restore(older []protocol.BufferedSample) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	newer := make([]protocol.BufferedSample, 0, b.count)
+	for i := 0; i < b.count; i++ {
+		newer = append(newer, b.ring[(b.head+i)%len(b.ring)])
+	}
+	b.head, b.count = 0, 0
+
+	for _, sample := range older {
+		b.pushLocked(sample)
+	}
+	for _, sample := range newer {
+		b.pushLocked(sample)
+	}
+}
+
+// takeDropped returns and resets the number of samples lost to overflow.
+func (b *offlineBuffer) takeDropped() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := b.dropped
+	b.dropped = 0
+	return n
+}
+
+func readSpool(path string) ([]protocol.BufferedSample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var samples []protocol.BufferedSample
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4<<20)
+	for scanner.Scan() {
+		var sample protocol.BufferedSample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	return samples, scanner.Err()
+}
+
+// flush replays the buffered samples to the server in batches. Samples that
+// could not be sent are kept for the next reconnection.
+func (b *offlineBuffer) flush(conn messageWriter) error {
+	samples := b.drain()
+	if dropped := b.takeDropped(); dropped > 0 {
+		fmt.Printf("⚠️ %d buffered sample(s) were dropped while offline\n", dropped)
+	}
+	if len(samples) == 0 {
+		return nil
+	}
+
+	for start := 0; start < len(samples); start += replayBatchSize {
+		end := min(start+replayBatchSize, len(samples))
+		if err := sendSamplesReplay(conn, samples[start:end]); err != nil {
+			b.restore(samples[start:])
+			return err
+		}
+	}
+
+	fmt.Printf("📤 Replayed %d buffered sample(s)\n", len(samples))
+	return nil
+}
+
+func sendSamplesReplay(conn messageWriter, samples []protocol.BufferedSample) error {
+	msg := protocol.Message{
+		Type: "samples_replay",
+		Data: protocol.SamplesReplayData{Samples: samples},
+	}
+
+	return conn.writeMessage(msg)
+}
+
+// bufferingWriter sends metric messages through the link and, when the
+// server is unreachable, keeps them in the offline buffer with the time they
+// were produced.
+type bufferingWriter struct {
+	link   *serverLink
+	buffer *offlineBuffer
+}
+
+func (w *bufferingWriter) writeMessage(msg protocol.Message) error {
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+
+	err := w.link.writeMessage(msg)
+	if err == nil {
+		return nil
+	}
+
+	data, jsonErr := json.Marshal(msg.Data)
+	if jsonErr != nil {
+		return err
+	}
+
+	w.buffer.add(protocol.BufferedSample{
+		Timestamp: msg.Timestamp,
+		Type:      msg.Type,
+		Data:      data,
+	})
+	return nil
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"libs/protocol"
+	"libs/utils"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	minReconnectDelay = 500 * time.Millisecond
+	maxReconnectDelay = 30 * time.Second
+	// stableSession is how long a connection must last before the backoff is
+	// reset, so a server that accepts and immediately drops us is not hammered.
+	stableSession = 10 * time.Second
+)
+
+var errNotConnected = errors.New("not connected to server")
+
+// messageWriter is what the senders need: something that stamps, serializes
+// and delivers a protocol message.
+type messageWriter interface {
+	writeMessage(msg protocol.Message) error
+}
+
+// serverLink holds the current connection to the server. Metric senders write
+// through it so they keep working while the connection is replaced. The mutex
+// also serializes writes, seq numbers the messages of each connection and ack
+// keeps what the server of the current connection acknowledged.
+type serverLink struct {
+	mu   sync.Mutex
+	conn net.Conn
+	seq  uint64
+	ack  protocol.HandshakeAckData
+}
+
+func (l *serverLink) writeMessage(msg protocol.Message) error {
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return errNotConnected
+	}
+
+	msg.Seq = l.seq + 1
+	payload, err := protocol.Encode(msg)
+	if err != nil {
+		return err
+	}
+	l.seq++
+
+	_, err = l.conn.Write(payload)
+	return err
+}
+
+// Write sends raw bytes, used for the free text typed in the console.
+func (l *serverLink) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return 0, errNotConnected
+	}
+	return l.conn.Write(p)
+}
+
+// set swaps the active connection, restarting the sequence numbers.
+func (l *serverLink) set(conn net.Conn) {
+	l.mu.Lock()
+	l.conn = conn
+	l.seq = 0
+	l.mu.Unlock()
+}
+
+// adopt makes the connection of an established session the active one,
+// continuing the sequence numbers it used during the handshake.
+func (l *serverLink) adopt(session *serverLink, ack protocol.HandshakeAckData) {
+	session.mu.Lock()
+	conn, seq := session.conn, session.seq
+	session.mu.Unlock()
+
+	l.mu.Lock()
+	l.conn, l.seq, l.ack = conn, seq, ack
+	l.mu.Unlock()
+}
+
+// accepts reports whether the connected server understands messages added in
+// protocol version since. While disconnected everything is accepted: samples
+// go to the offline buffer and the server skips unknown types on replay.
+func (l *serverLink) accepts(since string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.conn == nil || l.ack.AtLeast(since)
+}
+
+func (l *serverLink) connected() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.conn != nil
+}
+
+// backoffDelay returns a "full jitter" exponential delay for the given attempt.
+func backoffDelay(attempt int) time.Duration {
+	ceiling := maxReconnectDelay
+	if attempt < 16 {
+		if d := minReconnectDelay << attempt; d < maxReconnectDelay {
+			ceiling = d
+		}
+	}
+	return minReconnectDelay/2 + rand.N(ceiling)
+}
+
+// maintainConnection dials the server (over TLS when tlsConfig is set),
+// performs the handshake and serves the connection until it drops, then
+// reconnects with backoff. It never returns.
+func maintainConnection(address string, tlsConfig *tls.Config, clientID, token string, link *serverLink, buffer *offlineBuffer, currentInterval func() time.Duration, onInterval func(time.Duration)) {
+	attempt := 0
+	for {
+		conn, err := utils.Dial(address, tlsConfig)
+		if err != nil {
+			delay := backoffDelay(attempt)
+			attempt++
+			fmt.Printf("❌ Could not connect to %s: %v (retrying in %s)\n", address, err, delay.Round(time.Millisecond))
+			time.Sleep(delay)
+			continue
+		}
+
+		fmt.Printf("✅ Connected to %s.\n", address)
+		started := time.Now()
+		reader := bufio.NewReader(conn)
+
+		ack, sessionErr := startSession(conn, reader, link, buffer, clientID, token, currentInterval)
+		if sessionErr != nil {
+			fmt.Println("❌ Error starting session:", sessionErr)
+		} else {
+			idle := time.Duration(ack.HeartbeatMs) * time.Millisecond * heartbeatMisses
+			sessionErr = listenServer(conn, reader, link, idle, onInterval)
+			fmt.Println("❌ Connection closed by server:", sessionErr)
+		}
+
+		// Close first so a writer blocked on the dead socket releases the link.
+		conn.Close()
+		link.set(nil)
+
+		// A planned shutdown is not a failure: retry as if starting fresh.
+		if time.Since(started) >= stableSession || errors.Is(sessionErr, errServerShutdown) {
+			attempt = 0
+		}
+		delay := backoffDelay(attempt)
+		if errors.Is(sessionErr, errReplaced) {
+			// Another agent uses our ID: do not immediately kick it back.
+			delay = maxReconnectDelay
+		}
+		attempt++
+		fmt.Printf("🔄 Reconnecting in %s...\n", delay.Round(time.Millisecond))
+		time.Sleep(delay)
+	}
+}
+
+// startSession replays everything the server needs to know about this agent
+// on a fresh connection: identity, static data, the current interval and the
+// samples buffered while offline (when the server accepts them). It returns
+// what the server acknowledged.
+//
+// The handshake runs on a private link; conn is only published on link once
+// the server acknowledged it, so until then the stats ticker keeps buffering
+// instead of sending metrics the server would reject.
+func startSession(conn net.Conn, reader *bufio.Reader, link *serverLink, buffer *offlineBuffer, clientID, token string, currentInterval func() time.Duration) (protocol.HandshakeAckData, error) {
+	session := &serverLink{}
+	session.set(conn)
+
+	if err := sendHandshake(session, clientID, token); err != nil {
+		return protocol.HandshakeAckData{}, fmt.Errorf("handshake: %w", err)
+	}
+	ack, err := awaitHandshakeAck(conn, reader)
+	if err != nil {
+		return ack, fmt.Errorf("handshake: %w", err)
+	}
+	fmt.Printf("🤝 Handshake accepted (protocol %s, features %v)\n", ack.Version, ack.Features)
+	if ack.ClientID != "" && ack.ClientID != clientID {
+		fmt.Printf("⚠️ Client ID %s already in use on the server; registered as %s\n", clientID, ack.ClientID)
+	}
+	if err := sendGeneralData(session); err != nil {
+		fmt.Println("❌ Error sending general data:", err)
+	}
+	if err := sendIntervalUpdate(session, currentInterval()); err != nil {
+		fmt.Println("⚠️ Could not notify initial interval:", err)
+	}
+
+	link.adopt(session, ack)
+	if skipped := unsupportedCollectors(ack); len(skipped) > 0 {
+		fmt.Printf("⚠️ Server speaks protocol %s; not sending %s\n", ack.Version, strings.Join(skipped, ", "))
+	}
+	if !ack.Supports(protocol.FeatureSamplesReplay) {
+		// Keep the samples: a server with history enabled may accept them later.
+		return ack, nil
+	}
+	if err := buffer.flush(link); err != nil {
+		fmt.Println("❌ Error replaying buffered samples:", err)
+	}
+	return ack, nil
+}
@@ -2,58 +2,96 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"libs/protocol"
-	"libs/utils"
 	"net"
 	"time"
 )
 
-func listenServer(conn net.Conn, onInterval func(time.Duration), onClose func(error)) {
-	reader := bufio.NewReader(conn)
+// heartbeatMisses is how many server heartbeats may be missed before the
+// connection is considered dead.
+const heartbeatMisses = 3
+
+// errReplaced means another connection took over our client_id on the server.
+var errReplaced = errors.New("client_id taken over by another connection")
+
+// errServerShutdown means the server announced it is stopping.
+var errServerShutdown = errors.New("server shutting down")
+
+// listenServer handles the messages sent by the server until the connection
+// fails. When idle is positive (the server pings us), a server silent for that
+// long is treated as gone so the agent reconnects instead of hanging.
+func listenServer(conn net.Conn, reader *bufio.Reader, link messageWriter, idle time.Duration, onInterval func(time.Duration)) error {
 	for {
+		if idle > 0 {
+			if err := conn.SetReadDeadline(time.Now().Add(idle)); err != nil {
+				return err
+			}
+		}
+
 		line, err := reader.ReadBytes('\n')
 		if err != nil {
-			onClose(err)
-			return
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return fmt.Errorf("no heartbeat from server in %s", idle)
+			}
+			return err
 		}
 
-		var msg protocol.Message
-		if err := json.Unmarshal(line, &msg); err != nil {
+		msg, err := protocol.Decode(line)
+		if errors.Is(err, protocol.ErrUnknownType) {
+			// ignore message types this agent does not know
+			continue
+		}
+		if err != nil {
 			fmt.Println("❌ Error decoding message from server:", err)
 			continue
 		}
 
 		switch msg.Type {
-		case "set_interval":
-			var data protocol.IntervalUpdateData
-			if err := utils.ParseData(msg.Data, &data); err != nil {
-				fmt.Println("❌ Error parsing set_interval data:", err)
-				continue
+		case "ping":
+			data := msg.Data.(*protocol.HeartbeatData)
+			if err := link.writeMessage(protocol.Message{Type: "pong", Data: *data}); err != nil {
+				fmt.Println("❌ Error answering server ping:", err)
 			}
+		case "set_interval":
+			data := msg.Data.(*protocol.IntervalUpdateData)
 			if data.IntervalMs <= 0 {
 				fmt.Println("⚠️ Invalid interval received from server:", data.IntervalMs)
 				continue
 			}
 			onInterval(time.Duration(data.IntervalMs) * time.Millisecond)
+		case "error":
+			data := msg.Data.(*protocol.ErrorData)
+			printServerError(*data)
+			if data.Code == protocol.ErrorConflict {
+				return errReplaced
+			}
+		case "server_shutdown":
+			data := msg.Data.(*protocol.ServerShutdownData)
+			fmt.Printf("\n🛑 Server is shutting down: %s\n", data.Reason)
+			return errServerShutdown
 		default:
 			// ignore other message types for now
 		}
 	}
 }
 
-func sendIntervalUpdate(conn net.Conn, interval time.Duration) error {
+// printServerError shows in the console an error the server reported about
+// one of our messages.
+func printServerError(data protocol.ErrorData) {
+	ref := ""
+	if data.RefType != "" {
+		ref = fmt.Sprintf(" (in reply to %s)", data.RefType)
+	}
+	fmt.Printf("\n⚠️ Server error [%s]: %s%s\n> ", data.Code, data.Message, ref)
+}
+
+func sendIntervalUpdate(conn messageWriter, interval time.Duration) error {
 	msg := protocol.Message{
 		Type: "interval_update",
 		Data: protocol.IntervalUpdateData{IntervalMs: interval.Milliseconds()},
 	}
-	bytes, err := json.Marshal(msg)
-	if err != nil {
-		return err
-	}
-	writeMu.Lock()
-	_, err = conn.Write(append(bytes, '\n'))
-	writeMu.Unlock()
-	return err
+	return conn.writeMessage(msg)
 }
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"libs/protocol"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// defaultDiskExclude skips snap images and virtual block devices, which would
+// otherwise show up as physical disks.
+const defaultDiskExclude = "squashfs,loop*,ram*"
+
+// diskFilter selects the filesystems and devices reported by the agent. The
+// physical filesystems are always candidates; include adds others (tmpfs,
+// overlay...) and exclude removes any match, winning over include. Patterns
+// use path.Match syntax and are tried against the mount point and its parent
+// directories, the filesystem type and the device (full path and base name),
+// so "/mnt/*" also covers the mounts nested below /mnt.
+type diskFilter struct {
+	include []string
+	exclude []string
+}
+
+// diskMounts is set from the command line flags before the ticker starts.
+var diskMounts = newDiskFilter("", defaultDiskExclude)
+
+// newDiskFilter parses the comma separated include and exclude lists.
+func newDiskFilter(include, exclude string) diskFilter {
+	return diskFilter{include: splitPatterns(include), exclude: splitPatterns(exclude)}
+}
+
+// validate reports the first malformed pattern.
+func (f diskFilter) validate() error {
+	for _, pattern := range append(append([]string(nil), f.include...), f.exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid disk pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func splitPatterns(list string) []string {
+	var patterns []string
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// matchAny reports whether any of the values matches one of the patterns.
+func matchAny(patterns []string, values ...string) bool {
+	for _, pattern := range patterns {
+		for _, value := range values {
+			if ok, _ := path.Match(pattern, value); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f diskFilter) excluded(values ...string) bool {
+	return matchAny(f.exclude, values...)
+}
+
+// partitions returns the mounted filesystems selected by the filter. A device
+// mounted more than once (bind mounts) is reported at its first mount point.
+func (f diskFilter) partitions() ([]disk.PartitionStat, error) {
+	physical, err := disk.Partitions(false)
+	if err != nil {
+		return nil, err
+	}
+	candidates := physical
+	if len(f.include) > 0 {
+		all, err := disk.Partitions(true)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range all {
+			if matchAny(f.include, partitionKeys(p)...) {
+				candidates = append(candidates, p)
+			}
+		}
+	}
+
+	seenMounts := make(map[string]bool)
+	seenDevices := make(map[string]bool)
+	var selected []disk.PartitionStat
+	for _, p := range candidates {
+		if seenMounts[p.Mountpoint] || f.excluded(partitionKeys(p)...) {
+			continue
+		}
+		if strings.HasPrefix(p.Device, "/dev/") {
+			if seenDevices[p.Device] {
+				continue
+			}
+			seenDevices[p.Device] = true
+		}
+		seenMounts[p.Mountpoint] = true
+		selected = append(selected, p)
+	}
+	return selected, nil
+}
+
+// partitionKeys lists the values the filter patterns are matched against.
+func partitionKeys(p disk.PartitionStat) []string {
+	keys := []string{p.Fstype, p.Device, filepath.Base(p.Device)}
+	for dir := p.Mountpoint; ; dir = path.Dir(dir) {
+		keys = append(keys, dir)
+		if dir == "/" || dir == "." {
+			return keys
+		}
+	}
+}
+
+// sendDiskUsage reports the space and inodes of every selected filesystem.
+// The top level fields keep describing the root volume, as before mounts
+// were added.
+func sendDiskUsage(conn messageWriter) error {
+	partitions, err := diskMounts.partitions()
+	if err != nil {
+		return err
+	}
+
+	var (
+		data   protocol.DiskUsageData
+		root   bool
+		failed []string
+	)
+	for _, p := range partitions {
+		usage, err := disk.Usage(p.Mountpoint)
+		if err != nil {
+			failed = append(failed, p.Mountpoint)
+			continue
+		}
+		data.Mounts = append(data.Mounts, protocol.MountUsage{
+			Mountpoint:        p.Mountpoint,
+			Device:            p.Device,
+			Fstype:            p.Fstype,
+			Total:             usage.Total,
+			Used:              usage.Used,
+			Free:              usage.Free,
+			UsedPercent:       usage.UsedPercent,
+			InodesTotal:       usage.InodesTotal,
+			InodesUsed:        usage.InodesUsed,
+			InodesUsedPercent: usage.InodesUsedPercent,
+		})
+		if p.Mountpoint == "/" {
+			data.Total, data.Used, data.Free, data.UsedPercent = usage.Total, usage.Used, usage.Free, usage.UsedPercent
+			root = true
+		}
+	}
+
+	if !root {
+		usage, err := disk.Usage("/")
+		if err != nil {
+			return fmt.Errorf("root volume: %w", err)
+		}
+		data.Total, data.Used, data.Free, data.UsedPercent = usage.Total, usage.Used, usage.Free, usage.UsedPercent
+	}
+
+	sort.Slice(data.Mounts, func(i, j int) bool {
+		return data.Mounts[i].Mountpoint < data.Mounts[j].Mountpoint
+	})
+
+	msg := protocol.Message{
+		Type: "disk_usage",
+		Data: data,
+	}
+	if err := conn.writeMessage(msg); err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("could not read %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// sysBlockDir lists the block devices of the host on Linux.
+const sysBlockDir = "/sys/block"
+
+// wholeDisks returns the block devices whose I/O is not already counted under
+// another device: the entries of dir (partitions live below their disk, so
+// sda1 is not one) that are not stacked on other devices, like device-mapper
+// and md volumes built from partitions. It returns nil when dir cannot be
+// read, e.g. off Linux, where the counters only cover whole disks anyway.
+func wholeDisks(dir string) map[string]bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	disks := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if slaves, err := os.ReadDir(filepath.Join(dir, name, "slaves")); err == nil && len(slaves) > 0 {
+			continue
+		}
+		disks[name] = true
+	}
+	return disks
+}
+
+// diskCounters keeps the previous reading of the block device counters, from
+// which sendDiskIO derives the rates. Only the stats ticker uses it.
+var diskCounters struct {
+	at    time.Time
+	stats map[string]disk.IOCountersStat
+}
+
+// sendDiskIO reports, for every whole disk not excluded by the filter, the
+// operations and bytes per second and how busy it was since the previous
+// tick. Partitions and stacked volumes are left out so summing the devices
+// counts each I/O once. The first call only records the baseline and sends
+// nothing.
+func sendDiskIO(conn messageWriter) error {
+	counters, err := disk.IOCounters()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	previous, elapsed := diskCounters.stats, now.Sub(diskCounters.at).Seconds()
+	diskCounters.at = now
+	diskCounters.stats = counters
+	if previous == nil || elapsed <= 0 {
+		return nil
+	}
+
+	devices := diskDeviceRates(counters, previous, elapsed, wholeDisks(sysBlockDir))
+
+	// Containers often see no block devices, or --disk-exclude hides them all.
+	if len(devices) == 0 {
+		return nil
+	}
+
+	msg := protocol.Message{
+		Type: "disk_io",
+		Data: protocol.DiskIOData{
+			Devices: devices,
+		},
+	}
+
+	return conn.writeMessage(msg)
+}
+
+// diskDeviceRates turns two readings of the counters taken elapsed seconds
+// apart into per-device rates, sorted by name. When disks is not nil, only
+// the devices in it are reported.
+func diskDeviceRates(counters, previous map[string]disk.IOCountersStat, elapsed float64, disks map[string]bool) []protocol.DiskDeviceIO {
+	var devices []protocol.DiskDeviceIO
+	for name, c := range counters {
+		before, ok := previous[name]
+		if !ok || (disks != nil && !disks[name]) || diskMounts.excluded(name, "/dev/"+name) {
+			continue
+		}
+		// IoTime counts the milliseconds the device had requests in flight.
+		busy := counterRate(c.IoTime, before.IoTime, elapsed) / 10
+		devices = append(devices, protocol.DiskDeviceIO{
+			Name:             name,
+			ReadsPerSec:      counterRate(c.ReadCount, before.ReadCount, elapsed),
+			WritesPerSec:     counterRate(c.WriteCount, before.WriteCount, elapsed),
+			ReadBytesPerSec:  counterRate(c.ReadBytes, before.ReadBytes, elapsed),
+			WriteBytesPerSec: counterRate(c.WriteBytes, before.WriteBytes, elapsed),
+			BusyPercent:      min(busy, 100),
+		})
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Name < devices[j].Name
+	})
+	return devices
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// fakeSysBlock lays out a /sys/block with a disk holding two partitions and
+// a device-mapper volume built on one of them.
+func fakeSysBlock(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, p := range []string{"sda/sda1", "sda/sda2", "dm-0/slaves/sda2", "nvme0n1"} {
+		if err := os.MkdirAll(filepath.Join(dir, p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestWholeDisks(t *testing.T) {
+	disks := wholeDisks(fakeSysBlock(t))
+	if len(disks) != 2 || !disks["sda"] || !disks["nvme0n1"] {
+		t.Fatalf("wholeDisks = %v, want sda and nvme0n1", disks)
+	}
+	if wholeDisks(filepath.Join(t.TempDir(), "missing")) != nil {
+		t.Fatal("wholeDisks without sysfs should not filter")
+	}
+}
+
+func TestDiskDeviceRatesCountsEachIOOnce(t *testing.T) {
+	// 1 MiB was written through dm-0 onto sda2, so sda, sda2 and dm-0 all
+	// report it; nvme0n1 read 4 KiB.
+	previous := map[string]disk.IOCountersStat{
+		"sda": {}, "sda1": {}, "sda2": {}, "dm-0": {}, "nvme0n1": {},
+	}
+	counters := map[string]disk.IOCountersStat{
+		"sda":     {WriteCount: 8, WriteBytes: 1 << 20},
+		"sda1":    {},
+		"sda2":    {WriteCount: 8, WriteBytes: 1 << 20},
+		"dm-0":    {WriteCount: 8, WriteBytes: 1 << 20},
+		"nvme0n1": {ReadCount: 1, ReadBytes: 4096},
+	}
+
+	devices := diskDeviceRates(counters, previous, 1, wholeDisks(fakeSysBlock(t)))
+
+	var names []string
+	var read, written float64
+	for _, d := range devices {
+		names = append(names, d.Name)
+		read += d.ReadBytesPerSec
+		written += d.WriteBytesPerSec
+	}
+	if len(names) != 2 || names[0] != "nvme0n1" || names[1] != "sda" {
+		t.Fatalf("devices = %v, want [nvme0n1 sda]", names)
+	}
+	if read != 4096 || written != 1<<20 {
+		t.Fatalf("total read %v written %v, want 4096 and %d", read, written, 1<<20)
+	}
+}
@@ -1,28 +1,68 @@
 package main
 
 import (
-	"encoding/json"
+	"bufio"
+	"errors"
+	"fmt"
 	"libs/protocol"
 	"net"
+	"time"
 )
 
-func sendHandshake(conn net.Conn, clientID string) error {
+// handshakeTimeout bounds the wait for handshake_ack; servers older than the
+// negotiation never send it and are then treated as legacy.
+const handshakeTimeout = 5 * time.Second
+
+var errHandshakeRejected = errors.New("handshake rejected by server")
+
+func sendHandshake(conn messageWriter, clientID, token string) error {
 	msg := protocol.Message{
 		Type: "handshake",
 		Data: protocol.HandshakeData{
 			ClientID: clientID,
-			Version:  "1.0.0",
+			Version:  protocol.ProtocolVersion,
 			Role:     "client",
+			Token:    token,
+			Features: []string{protocol.FeatureSamplesReplay, protocol.FeatureHeartbeat},
 		},
 	}
 
-	jsonBytes, err := json.Marshal(msg)
-	if err != nil {
-		return err
+	return conn.writeMessage(msg)
+}
+
+// awaitHandshakeAck reads the server answer to the handshake. A server that
+// stays silent is assumed to speak protocol.LegacyVersion without optional
+// features.
+func awaitHandshakeAck(conn net.Conn, reader *bufio.Reader) (protocol.HandshakeAckData, error) {
+	legacy := protocol.HandshakeAckData{Version: protocol.LegacyVersion}
+
+	if err := conn.SetReadDeadline(time.Now().Add(handshakeTimeout)); err != nil {
+		return legacy, err
 	}
+	defer conn.SetReadDeadline(time.Time{})
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				fmt.Printf("⚠️ Server did not acknowledge the handshake; assuming protocol %s\n", legacy.Version)
+				return legacy, nil
+			}
+			return legacy, err
+		}
 
-	writeMu.Lock()
-	_, err = conn.Write(append(jsonBytes, '\n'))
-	writeMu.Unlock()
-	return err
+		msg, err := protocol.Decode(line)
+		if err != nil {
+			continue
+		}
+
+		switch msg.Type {
+		case "handshake_ack":
+			return *msg.Data.(*protocol.HandshakeAckData), nil
+		case "handshake_error":
+			data := msg.Data.(*protocol.HandshakeErrorData)
+			return legacy, fmt.Errorf("%w: %s (server protocol %s)", errHandshakeRejected, data.Reason, data.Version)
+		}
+	}
 }
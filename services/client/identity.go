@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultIdentityPath is where the generated client ID is kept when neither
+// --id nor --id-file is given.
+func defaultIdentityPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ".client-id"
+	}
+	return filepath.Join(dir, "ach-monitor", "client-id")
+}
+
+// loadOrCreateIdentity returns the client ID stored at path, generating and
+// persisting a random UUID the first time so the agent keeps the same
+// identity (and history) across restarts.
+func loadOrCreateIdentity(path string) (string, error) {
+	raw, err := os.ReadFile(path)
+	if err == nil {
+		if id := strings.TrimSpace(string(raw)); id != "" {
+			return id, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	id, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(path, []byte(id+"\n"), 0o644); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
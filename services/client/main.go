@@ -2,8 +2,10 @@ package main
 
 import (
 	"bufio"
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"libs/utils"
 	"net"
 	"os"
 	"strconv"
@@ -12,33 +14,53 @@ import (
 	"time"
 )
 
-var writeMu sync.Mutex
-
 func main() {
 	host := flag.String("host", "localhost", "Server host or IP")
 	port := flag.Int("port", 8080, "Server TCP port")
-	clientID := flag.String("id", "client", "Client identifier for handshake")
+	clientID := flag.String("id", "", "Client identifier for handshake (default: a UUID persisted in --id-file)")
+	idFile := flag.String("id-file", defaultIdentityPath(), "File keeping the generated client identifier when --id is not given")
+	bufferSize := flag.Int("buffer-size", 1000, "Samples kept in memory while disconnected")
+	spoolPath := flag.String("spool", "", "File where samples overflowing the in-memory buffer are spooled (empty disables it)")
+	spoolMaxMB := flag.Int64("spool-max-mb", 64, "Maximum size of the spool file in MiB")
+	token := flag.String("token", os.Getenv("MONITORING_TOKEN"), "Authentication token sent in the handshake (default from $MONITORING_TOKEN)")
+	useTLS := flag.Bool("tls", false, "Connect to the server over TLS")
+	tlsCA := flag.String("tls-ca", "", "PEM CA used to verify the server (implies --tls)")
+	tlsCert := flag.String("tls-cert", "", "PEM client certificate for mutual TLS (implies --tls)")
+	tlsKey := flag.String("tls-key", "", "PEM private key of the client certificate")
+	tlsServerName := flag.String("tls-server-name", "", "Name expected in the server certificate (defaults to --host)")
+	diskInclude := flag.String("disk-include", "", "Comma separated patterns of extra filesystems to report besides the physical ones, e.g. tmpfs,overlay (matched against mount point, type or device)")
+	diskExclude := flag.String("disk-exclude", defaultDiskExclude, "Comma separated patterns of filesystems and devices not to report (matched against mount point, type or device)")
 	flag.Parse()
 
-	address := fmt.Sprintf("%s:%d", *host, *port)
+	address := net.JoinHostPort(*host, strconv.Itoa(*port))
 
-	conn, err := net.Dial("tcp", address)
-	if err != nil {
-		panic(err)
+	diskMounts = newDiskFilter(*diskInclude, *diskExclude)
+	if err := diskMounts.validate(); err != nil {
+		fmt.Println("❌", err)
+		os.Exit(1)
 	}
-	defer conn.Close()
 
-	fmt.Printf("✅ Connected to %s. Type messages:\n", address)
-
-	// Send handshake message
-	err = sendHandshake(conn, *clientID)
-	if err != nil {
-		fmt.Println("❌ Error sending handshake:", err)
-		return
+	if *clientID == "" {
+		id, err := loadOrCreateIdentity(*idFile)
+		if err != nil {
+			fmt.Println("❌ Could not load client identity:", err)
+			os.Exit(1)
+		}
+		*clientID = id
+		fmt.Printf("🪪 Using client ID %s (from %s)\n", id, *idFile)
 	}
-	if err := sendGeneralData(conn); err != nil {
-		fmt.Println("❌ Error sending general data:", err)
+
+	var tlsConfig *tls.Config
+	if *useTLS || *tlsCA != "" || *tlsCert != "" {
+		cfg, err := utils.ClientTLSConfig(*tlsCA, *tlsCert, *tlsKey, *tlsServerName)
+		if err != nil {
+			fmt.Println("❌ Invalid TLS configuration:", err)
+			os.Exit(1)
+		}
+		tlsConfig = cfg
 	}
+	link := &serverLink{}
+	buffer := newOfflineBuffer(*bufferSize, *spoolPath, *spoolMaxMB<<20)
 
 	defaultInterval := 5 * time.Second
 	intervalUpdates := make(chan time.Duration, 1)
@@ -48,6 +70,12 @@ func main() {
 		currentInterval = defaultInterval
 	)
 
+	getInterval := func() time.Duration {
+		intervalMu.Lock()
+		defer intervalMu.Unlock()
+		return currentInterval
+	}
+
 	setInterval := func(newInterval time.Duration, source string, notify bool) {
 		if newInterval <= 0 {
 			fmt.Println("❌ Interval must be greater than zero.")
@@ -69,30 +97,33 @@ func main() {
 			}
 		}
 		fmt.Printf("⏱️ Stats interval set to %dms (%s)\n", newInterval.Milliseconds(), source)
-		if notify {
-			if err := sendIntervalUpdate(conn, newInterval); err != nil {
+		if notify && link.connected() {
+			if err := sendIntervalUpdate(link, newInterval); err != nil {
 				fmt.Println("❌ Error notifying interval update:", err)
 			}
 		}
 	}
 
-	go startStatsTicker(conn, defaultInterval, intervalUpdates)
+	// The ticker outlives individual connections; while disconnected, and
+	// until a new handshake is acknowledged, its samples are kept in the
+	// offline buffer and the connection goroutine redoes the handshake,
+	// general data and interval and replays them once the server is back.
+	go startStatsTicker(&bufferingWriter{link: link, buffer: buffer}, link.accepts, defaultInterval, intervalUpdates)
 
-	go listenServer(conn, func(interval time.Duration) {
+	go maintainConnection(address, tlsConfig, *clientID, *token, link, buffer, getInterval, func(interval time.Duration) {
 		setInterval(interval, "servidor", true)
-	}, func(err error) {
-		fmt.Println("❌ Connection closed by server:", err)
-		os.Exit(1)
 	})
 
-	if err := sendIntervalUpdate(conn, currentInterval); err != nil {
-		fmt.Println("⚠️ Could not notify initial interval:", err)
-	}
-
+	fmt.Println("Type messages:")
+	stdin := bufio.NewReader(os.Stdin)
 	for {
 		// Read input from terminal
 		fmt.Print("> ")
-		text, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		text, err := stdin.ReadString('\n')
+		if err != nil {
+			// stdin closed (e.g. running as a service): keep collecting metrics.
+			select {}
+		}
 		trimmed := strings.TrimSpace(text)
 
 		if strings.HasPrefix(trimmed, "/interval ") {
@@ -106,12 +137,9 @@ func main() {
 		}
 
 		// Send message
-		writeMu.Lock()
-		_, err = conn.Write([]byte(text))
-		writeMu.Unlock()
+		_, err = link.Write([]byte(text))
 		if err != nil {
 			fmt.Println("❌ Error sending:", err)
-			break
 		}
 	}
 }
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"libs/protocol"
 	"net"
@@ -9,12 +8,14 @@ import (
 	"time"
 
 	"github.com/shirou/gopsutil/v3/cpu"
-	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
 	"github.com/shirou/gopsutil/v3/mem"
+	psnet "github.com/shirou/gopsutil/v3/net"
 	"github.com/shirou/gopsutil/v3/process"
 )
 
-func sendCpuUsage(conn net.Conn) error {
+func sendCpuUsage(conn messageWriter) error {
 	coresPercent, err := cpu.Percent(0, true)
 	if err != nil {
 		return err
@@ -37,18 +38,10 @@ func sendCpuUsage(conn net.Conn) error {
 		},
 	}
 
-	jsonBytes, err := json.Marshal(msg)
-	if err != nil {
-		return err
-	}
-
-	writeMu.Lock()
-	_, err = conn.Write(append(jsonBytes, '\n'))
-	writeMu.Unlock()
-	return err
+	return conn.writeMessage(msg)
 }
 
-func sendMemoryUsage(conn net.Conn) error {
+func sendMemoryUsage(conn messageWriter) error {
 	vmStat, err := mem.VirtualMemory()
 	if err != nil {
 		return err
@@ -63,68 +56,98 @@ func sendMemoryUsage(conn net.Conn) error {
 		},
 	}
 
-	jsonBytes, err := json.Marshal(msg)
-	if err != nil {
-		return err
-	}
-
-	writeMu.Lock()
-	_, err = conn.Write(append(jsonBytes, '\n'))
-	writeMu.Unlock()
-	return err
+	return conn.writeMessage(msg)
 }
 
-func sendDiskUsage(conn net.Conn) error {
-	usage, _ := disk.Usage("/")
+// sendGeneralData describes the host: CPU model and core counts, plus the
+// hostname, OS, kernel and boot time when they can be read.
+func sendGeneralData(conn messageWriter) error {
+	cpuStats, err := cpu.Info()
+	if err != nil || len(cpuStats) == 0 {
+		return fmt.Errorf("failed to get CPU info")
+	}
+
+	data := protocol.GeneralData{
+		ModelName: cpuStats[0].ModelName,
+		Cores:     cpuStats[0].Cores,
+		Mhz:       cpuStats[0].Mhz,
+	}
+	if n, err := cpu.Counts(true); err == nil {
+		data.LogicalCores = n
+	}
+	if n, err := cpu.Counts(false); err == nil {
+		data.PhysicalCores = n
+	}
+	if info, err := host.Info(); err == nil {
+		data.Hostname = info.Hostname
+		data.OS = info.OS
+		data.Platform = info.Platform
+		data.PlatformVersion = info.PlatformVersion
+		data.KernelVersion = info.KernelVersion
+		data.KernelArch = info.KernelArch
+		if info.BootTime > 0 {
+			data.BootTime = time.Unix(int64(info.BootTime), 0)
+		}
+	} else {
+		fmt.Println("⚠️ Could not read host information:", err)
+	}
 
 	msg := protocol.Message{
-		Type: "disk_usage",
-		Data: protocol.DiskUsageData{
-			Total:       usage.Total,
-			Used:        usage.Used,
-			Free:        usage.Free,
-			UsedPercent: usage.UsedPercent,
-		},
+		Type: "general_data",
+		Data: data,
 	}
 
-	jsonBytes, err := json.Marshal(msg)
+	return conn.writeMessage(msg)
+}
+
+// contextSwitches keeps the previous context switch count, from which
+// sendSystemLoad derives the rate. Only the stats ticker uses it.
+var contextSwitches struct {
+	at    time.Time
+	count uint64
+}
+
+// sendSystemLoad reports the load averages, swap usage, runnable and blocked
+// processes and the context switch rate since the previous tick (zero on the
+// first one). Process and context switch counts are only available on Linux.
+func sendSystemLoad(conn messageWriter) error {
+	avg, err := load.Avg()
+	if err != nil {
+		return err
+	}
+	swap, err := mem.SwapMemory()
 	if err != nil {
 		return err
 	}
 
-	writeMu.Lock()
-	_, err = conn.Write(append(jsonBytes, '\n'))
-	writeMu.Unlock()
-	return err
-}
-
-func sendGeneralData(conn net.Conn) error {
-	cpuStats, err := cpu.Info()
-	if err != nil || len(cpuStats) == 0 {
-		return fmt.Errorf("failed to get CPU info")
+	data := protocol.SystemLoadData{
+		Load1:           avg.Load1,
+		Load5:           avg.Load5,
+		Load15:          avg.Load15,
+		SwapTotal:       swap.Total,
+		SwapUsed:        swap.Used,
+		SwapUsedPercent: swap.UsedPercent,
 	}
 
-	msg := protocol.Message{
-		Type: "general_data",
-		Data: protocol.GeneralData{
-			ModelName: cpuStats[0].ModelName,
-			Cores:     cpuStats[0].Cores,
-			Mhz:       cpuStats[0].Mhz,
-		},
+	if misc, err := load.Misc(); err == nil {
+		now, count := time.Now(), uint64(misc.Ctxt)
+		if !contextSwitches.at.IsZero() {
+			data.ContextSwitchesPerSec = counterRate(count, contextSwitches.count, now.Sub(contextSwitches.at).Seconds())
+		}
+		contextSwitches.at, contextSwitches.count = now, count
+		data.ProcsRunning = misc.ProcsRunning
+		data.ProcsBlocked = misc.ProcsBlocked
 	}
 
-	jsonBytes, err := json.Marshal(msg)
-	if err != nil {
-		return err
+	msg := protocol.Message{
+		Type: "system_load",
+		Data: data,
 	}
 
-	writeMu.Lock()
-	_, err = conn.Write(append(jsonBytes, '\n'))
-	writeMu.Unlock()
-	return err
+	return conn.writeMessage(msg)
 }
 
-func sendProcessUsage(conn net.Conn, maxEntries int) error {
+func sendProcessUsage(conn messageWriter, maxEntries int) error {
 	if maxEntries <= 0 {
 		maxEntries = 10
 	}
@@ -190,11 +213,97 @@ func sendProcessUsage(conn net.Conn, maxEntries int) error {
 		},
 	}
 
-	jsonBytes, err := json.Marshal(msg)
+	return conn.writeMessage(msg)
+}
+
+// networkCounters keeps the previous reading of the interface counters, from
+// which sendNetworkUsage derives the rates. Only the stats ticker uses it.
+var networkCounters struct {
+	at    time.Time
+	stats map[string]psnet.IOCountersStat
+}
+
+// sendNetworkUsage reports, for every non-loopback interface, the traffic,
+// error and drop rates since the previous tick. The first call only records
+// the baseline and sends nothing.
+func sendNetworkUsage(conn messageWriter) error {
+	counters, err := psnet.IOCounters(true)
 	if err != nil {
 		return err
 	}
 
-	_, err = conn.Write(append(jsonBytes, '\n'))
-	return err
+	now := time.Now()
+	previous, elapsed := networkCounters.stats, now.Sub(networkCounters.at).Seconds()
+	networkCounters.at = now
+	networkCounters.stats = make(map[string]psnet.IOCountersStat, len(counters))
+	for _, c := range counters {
+		networkCounters.stats[c.Name] = c
+	}
+	if previous == nil || elapsed <= 0 {
+		return nil
+	}
+
+	loopback := loopbackInterfaces()
+	var interfaces []protocol.NetworkInterfaceUsage
+	for _, c := range counters {
+		before, ok := previous[c.Name]
+		if !ok || loopback[c.Name] {
+			continue
+		}
+		interfaces = append(interfaces, protocol.NetworkInterfaceUsage{
+			Name:             c.Name,
+			BytesInPerSec:    counterRate(c.BytesRecv, before.BytesRecv, elapsed),
+			BytesOutPerSec:   counterRate(c.BytesSent, before.BytesSent, elapsed),
+			PacketsInPerSec:  counterRate(c.PacketsRecv, before.PacketsRecv, elapsed),
+			PacketsOutPerSec: counterRate(c.PacketsSent, before.PacketsSent, elapsed),
+			ErrorsInPerSec:   counterRate(c.Errin, before.Errin, elapsed),
+			ErrorsOutPerSec:  counterRate(c.Errout, before.Errout, elapsed),
+			DropsInPerSec:    counterRate(c.Dropin, before.Dropin, elapsed),
+			DropsOutPerSec:   counterRate(c.Dropout, before.Dropout, elapsed),
+		})
+	}
+
+	// A host with only loopback interfaces has nothing to report.
+	if len(interfaces) == 0 {
+		return nil
+	}
+
+	sort.Slice(interfaces, func(i, j int) bool {
+		return interfaces[i].Name < interfaces[j].Name
+	})
+
+	msg := protocol.Message{
+		Type: "network_usage",
+		Data: protocol.NetworkUsageData{
+			Interfaces: interfaces,
+		},
+	}
+
+	return conn.writeMessage(msg)
+}
+
+// counterRate turns the growth of a cumulative counter into a per-second
+// rate. A counter lower than before means the device was reset and counts as
+// zero.
+func counterRate(current, before uint64, elapsed float64) float64 {
+	if current < before || elapsed <= 0 {
+		return 0
+	}
+	return float64(current-before) / elapsed
+}
+
+// loopbackInterfaces returns the names of the loopback interfaces, whose
+// traffic never leaves the host.
+func loopbackInterfaces() map[string]bool {
+	names := make(map[string]bool)
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return names
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			names[iface.Name] = true
+		}
+	}
+	return names
 }
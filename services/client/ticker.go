@@ -3,24 +3,58 @@ package main
 import (
 	"errors"
 	"fmt"
-	"net"
+	"libs/protocol"
 	"time"
 )
 
 const processSampleSize = 10
 
-func startStatsTicker(conn net.Conn, initial time.Duration, updates <-chan time.Duration) {
+// statsCollector is one of the metrics sent on every tick. since is the
+// protocol version that introduced its message type; empty means every
+// server understands it.
+type statsCollector struct {
+	name  string
+	since string
+	send  func(conn messageWriter) error
+}
+
+var statsCollectors = []statsCollector{
+	{name: "cpu usage", send: sendCpuUsage},
+	{name: "memory usage", send: sendMemoryUsage},
+	{name: "system load", since: "1.5.0", send: sendSystemLoad},
+	{name: "disk usage", send: sendDiskUsage},
+	{name: "disk io", since: "1.4.0", send: sendDiskIO},
+	{name: "process usage", send: func(conn messageWriter) error { return sendProcessUsage(conn, processSampleSize) }},
+	{name: "network usage", since: "1.3.0", send: sendNetworkUsage},
+}
+
+// unsupportedCollectors lists the collectors a server that negotiated ack
+// would reject as unknown types.
+func unsupportedCollectors(ack protocol.HandshakeAckData) []string {
+	var names []string
+	for _, c := range statsCollectors {
+		if c.since != "" && !ack.AtLeast(c.since) {
+			names = append(names, c.name)
+		}
+	}
+	return names
+}
+
+// startStatsTicker sends every collector on each tick. accepts tells whether
+// the server understands the message types added in a protocol version, so
+// collectors newer than the negotiated version are skipped.
+func startStatsTicker(conn messageWriter, accepts func(since string) bool, initial time.Duration, updates <-chan time.Duration) {
 	ticker := time.NewTicker(initial)
 	defer ticker.Stop()
 
-	if err := sendAllStats(conn); err != nil {
+	if err := sendAllStats(conn, accepts); err != nil && !errors.Is(err, errNotConnected) {
 		fmt.Println("❌ Error sending stats:", err)
 	}
 
 	for {
 		select {
 		case <-ticker.C:
-			if err := sendAllStats(conn); err != nil {
+			if err := sendAllStats(conn, accepts); err != nil && !errors.Is(err, errNotConnected) {
 				fmt.Println("❌ Error sending stats:", err)
 			}
 		case next, ok := <-updates:
@@ -37,20 +71,16 @@ func startStatsTicker(conn net.Conn, initial time.Duration, updates <-chan time.
 	}
 }
 
-func sendAllStats(conn net.Conn) error {
+func sendAllStats(conn messageWriter, accepts func(since string) bool) error {
 	var errs []error
 
-	if err := sendCpuUsage(conn); err != nil {
-		errs = append(errs, fmt.Errorf("cpu usage: %w", err))
-	}
-	if err := sendMemoryUsage(conn); err != nil {
-		errs = append(errs, fmt.Errorf("memory usage: %w", err))
-	}
-	if err := sendDiskUsage(conn); err != nil {
-		errs = append(errs, fmt.Errorf("disk usage: %w", err))
-	}
-	if err := sendProcessUsage(conn, processSampleSize); err != nil {
-		errs = append(errs, fmt.Errorf("process usage: %w", err))
+	for _, c := range statsCollectors {
+		if c.since != "" && !accepts(c.since) {
+			continue
+		}
+		if err := c.send(conn); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+		}
 	}
 
 	if len(errs) == 0 {
@@ -1,45 +1,53 @@
 package main
 
 import (
+	"bufio"
+	"crypto/tls"
 	"fmt"
-	"libs/protocol"
-	"net"
+	"libs/utils"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
-// runMonitor configura a conexão com o servidor e inicializa a interface TUI.
-func runMonitor(address string) error {
-	conn, err := net.Dial("tcp", address)
+// runMonitor configura a conexão com o servidor (via TLS quando tlsConfig não
+// é nil) e inicializa a interface TUI.
+func runMonitor(address string, tlsConfig *tls.Config, name, token string) error {
+	conn, err := utils.Dial(address, tlsConfig)
 	if err != nil {
 		return fmt.Errorf("não foi possível conectar ao servidor %s: %w", address, err)
 	}
 	defer conn.Close()
 
-	if err := sendMonitorHandshake(conn); err != nil {
+	if err := sendMonitorHandshake(conn, name, token); err != nil {
 		return fmt.Errorf("falha ao enviar handshake: %w", err)
 	}
 
+	reader := bufio.NewReader(conn)
+	server, err := awaitHandshakeAck(conn, reader)
+	if err != nil {
+		return err
+	}
+
 	if err := sendClientsRequest(conn); err != nil {
 		return fmt.Errorf("falha ao solicitar lista de clientes: %w", err)
 	}
 
 	app := tview.NewApplication()
-	ui := newMonitorUI(app, conn)
-	ui.setStatus("Conectado. Use ↑/↓ para navegar, [::b]r[::-] para atualizar, [::b]q[::-]/Esc para sair.")
+	ui := newMonitorUI(app, conn, server)
+	ui.refreshAlerts()
+	ui.setStatus(fmt.Sprintf("Conectado (protocolo %s). Use ↑/↓ para navegar, [::b]Tab[::-] para alternar com os alertas, [::b]a[::-] para reconhecer, [::b]r[::-] para atualizar, [::b]q[::-]/Esc para sair.", server.Version))
 
-	snapshotCh := make(chan []protocol.ClientStateSummary, 1)
-	updateCh := make(chan protocol.ClientStateSummary, 16)
-	removeCh := make(chan string, 16)
-	errCh := make(chan error, 1)
+	events := newServerEvents()
 
-	go listenServer(conn, snapshotCh, updateCh, removeCh, errCh)
+	idle := time.Duration(server.HeartbeatMs) * time.Millisecond * heartbeatMisses
+	go listenServer(conn, reader, idle, events)
 
 	go func() {
 		for {
 			select {
-			case list := <-snapshotCh:
+			case list := <-events.snapshots:
 				app.QueueUpdateDraw(func() {
 					ui.state.applySnapshot(list)
 					ui.refreshList()
@@ -49,18 +57,51 @@ func runMonitor(address string) error {
 						ui.setStatus(fmt.Sprintf("%d cliente(s) conectados. ↑/↓ para navegar, r para atualizar.", len(list)))
 					}
 				})
-			case update := <-updateCh:
+			case update := <-events.updates:
 				app.QueueUpdateDraw(func() {
 					ui.state.applyUpdate(update)
 					ui.refreshList()
 				})
-			case removed := <-removeCh:
+			case removed := <-events.removals:
 				app.QueueUpdateDraw(func() {
 					ui.state.applyRemoval(removed)
 					ui.refreshList()
 					ui.setStatus(fmt.Sprintf("Cliente %s desconectou.", removed))
 				})
-			case err := <-errCh:
+			case list := <-events.alerts:
+				app.QueueUpdateDraw(func() {
+					ui.state.applyAlertsSnapshot(list)
+					ui.refreshAlerts()
+				})
+			case alert := <-events.alert:
+				app.QueueUpdateDraw(func() {
+					ui.state.applyAlert(alert)
+					ui.refreshAlerts()
+					if alert.State == "firing" && alert.AckedBy == "" {
+						ui.setStatus(fmt.Sprintf("[%s]Alerta %s disparou em %s: %s", colorForSeverity(alert.Severity), alert.Rule, alert.ClientID, alert.Message))
+					}
+				})
+			case resp := <-events.history:
+				app.QueueUpdateDraw(func() {
+					if resp.Error != "" {
+						ui.setStatus(fmt.Sprintf("[yellow]Histórico indisponível para %s: %s", resp.ClientID, resp.Error))
+						return
+					}
+					ui.state.applyHistory(resp)
+					if resp.ClientID == ui.selected {
+						ui.renderDetails()
+					}
+				})
+			case failure := <-events.failures:
+				app.QueueUpdateDraw(func() {
+					ui.showServerError(failure)
+				})
+			case notice := <-events.shutdown:
+				app.QueueUpdateDraw(func() {
+					ui.setStatus(fmt.Sprintf("[yellow]Servidor encerrado (%s). Os dados exibidos não serão mais atualizados; [::b]q[::-] para sair.", notice.Reason))
+				})
+				return
+			case err := <-events.errs:
 				app.QueueUpdateDraw(func() {
 					ui.setStatus(fmt.Sprintf("[red]Conexão encerrada: %v", err))
 					app.Stop()
@@ -94,6 +135,12 @@ func runMonitor(address string) error {
 		case event.Key() == tcell.KeyRune && (event.Rune() == '-' || event.Rune() == '_'):
 			ui.changeSelectedInterval(intervalStepMs)
 			return nil
+		case event.Key() == tcell.KeyRune && (event.Rune() == 'a' || event.Rune() == 'A'):
+			ui.acknowledgeSelectedAlert()
+			return nil
+		case event.Key() == tcell.KeyTab:
+			ui.toggleFocus()
+			return nil
 		case event.Key() == tcell.KeyEscape:
 			app.Stop()
 			return nil
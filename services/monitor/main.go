@@ -1,20 +1,41 @@
 package main
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"libs/utils"
+	"net"
 	"os"
+	"strconv"
 )
 
 // main parses CLI flags and delegates execution to the TUI monitor runtime.
 func main() {
 	host := flag.String("host", "localhost", "Server host or IP")
 	port := flag.Int("port", 8080, "Server TCP port")
+	name := flag.String("name", "monitor", "Monitor name reported to the server (used in alert acknowledgements)")
+	token := flag.String("token", os.Getenv("MONITORING_TOKEN"), "Authentication token sent in the handshake (default from $MONITORING_TOKEN)")
+	useTLS := flag.Bool("tls", false, "Connect to the server over TLS")
+	tlsCA := flag.String("tls-ca", "", "PEM CA used to verify the server (implies --tls)")
+	tlsCert := flag.String("tls-cert", "", "PEM client certificate for mutual TLS (implies --tls)")
+	tlsKey := flag.String("tls-key", "", "PEM private key of the client certificate")
+	tlsServerName := flag.String("tls-server-name", "", "Name expected in the server certificate (defaults to --host)")
 	flag.Parse()
 
-	address := fmt.Sprintf("%s:%d", *host, *port)
+	address := net.JoinHostPort(*host, strconv.Itoa(*port))
 
-	if err := runMonitor(address); err != nil {
+	var tlsConfig *tls.Config
+	if *useTLS || *tlsCA != "" || *tlsCert != "" {
+		cfg, err := utils.ClientTLSConfig(*tlsCA, *tlsCert, *tlsKey, *tlsServerName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Invalid TLS configuration: %v\n", err)
+			os.Exit(1)
+		}
+		tlsConfig = cfg
+	}
+
+	if err := runMonitor(address, tlsConfig, *name, *token); err != nil {
 		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
 		os.Exit(1)
 	}
@@ -2,31 +2,139 @@ package main
 
 import (
 	"bufio"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"libs/protocol"
-	"libs/utils"
 	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// handshakeTimeout limita a espera pelo handshake_ack do servidor.
+const handshakeTimeout = 5 * time.Second
+
+// heartbeatMisses é quantos pings do servidor podem faltar antes de a conexão
+// ser considerada perdida.
+const heartbeatMisses = 3
+
+var (
+	// writeMu serializa as escritas no socket, feitas tanto pela UI quanto por
+	// goroutines auxiliares, e protege a numeração sequencial das mensagens.
+	writeMu  sync.Mutex
+	writeSeq uint64
+
+	// messageIDs gera identificadores para os comandos enviados, únicos
+	// entre execuções graças ao prefixo com o instante de início.
+	messageIDs      atomic.Uint64
+	messageIDPrefix = strconv.FormatInt(time.Now().UnixNano(), 36)
+)
+
+// newMessageID devolve um identificador para correlacionar respostas e erros.
+func newMessageID() string {
+	return fmt.Sprintf("%s-%d", messageIDPrefix, messageIDs.Add(1))
+}
+
+// serverEvents agrupa os canais pelos quais listenServer entrega as mensagens recebidas.
+type serverEvents struct {
+	snapshots chan []protocol.ClientStateSummary
+	updates   chan protocol.ClientStateSummary
+	removals  chan string
+	history   chan protocol.HistoryResponseData
+	alerts    chan []protocol.AlertData
+	alert     chan protocol.AlertData
+	failures  chan protocol.ErrorData
+	shutdown  chan protocol.ServerShutdownData
+	errs      chan error
+}
+
+// newServerEvents cria os canais com buffers adequados ao volume de cada mensagem.
+func newServerEvents() serverEvents {
+	return serverEvents{
+		snapshots: make(chan []protocol.ClientStateSummary, 1),
+		updates:   make(chan protocol.ClientStateSummary, 16),
+		removals:  make(chan string, 16),
+		history:   make(chan protocol.HistoryResponseData, 4),
+		alerts:    make(chan []protocol.AlertData, 1),
+		alert:     make(chan protocol.AlertData, 16),
+		failures:  make(chan protocol.ErrorData, 8),
+		shutdown:  make(chan protocol.ServerShutdownData, 1),
+		errs:      make(chan error, 1),
+	}
+}
+
+// writeMessage carimba horário e número de sequência, serializa a mensagem e
+// a envia terminada por \n.
+func writeMessage(conn net.Conn, msg protocol.Message) error {
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+
+	writeMu.Lock()
+	defer writeMu.Unlock()
+
+	msg.Seq = writeSeq + 1
+	payload, err := protocol.Encode(msg)
+	if err != nil {
+		return err
+	}
+	writeSeq++
+
+	_, err = conn.Write(payload)
+	return err
+}
+
 // sendMonitorHandshake identifica a conexão atual como monitor para o servidor.
-func sendMonitorHandshake(conn net.Conn) error {
+func sendMonitorHandshake(conn net.Conn, name, token string) error {
 	msg := protocol.Message{
 		Type: "handshake",
 		Data: protocol.HandshakeData{
-			ClientID: "monitor",
-			Version:  "1.0.0",
+			ClientID: name,
+			Version:  protocol.ProtocolVersion,
 			Role:     "monitor",
+			Token:    token,
+			Features: []string{protocol.FeatureHistory, protocol.FeatureAlerts, protocol.FeatureHeartbeat},
 		},
 	}
 
-	payload, err := json.Marshal(msg)
-	if err != nil {
-		return err
+	return writeMessage(conn, msg)
+}
+
+// awaitHandshakeAck lê a resposta do servidor ao handshake. Servidores
+// anteriores à negociação não respondem; após handshakeTimeout eles são
+// tratados como protocol.LegacyVersion, sem recursos opcionais.
+func awaitHandshakeAck(conn net.Conn, reader *bufio.Reader) (protocol.HandshakeAckData, error) {
+	legacy := protocol.HandshakeAckData{Version: protocol.LegacyVersion}
+
+	if err := conn.SetReadDeadline(time.Now().Add(handshakeTimeout)); err != nil {
+		return legacy, err
 	}
+	defer conn.SetReadDeadline(time.Time{})
 
-	_, err = conn.Write(append(payload, '\n'))
-	return err
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return legacy, nil
+			}
+			return legacy, err
+		}
+
+		msg, err := protocol.Decode(line)
+		if err != nil {
+			continue
+		}
+
+		switch msg.Type {
+		case "handshake_ack":
+			return *msg.Data.(*protocol.HandshakeAckData), nil
+		case "handshake_error":
+			data := msg.Data.(*protocol.HandshakeErrorData)
+			return legacy, fmt.Errorf("servidor recusou o handshake: %s (protocolo do servidor %s)", data.Reason, data.Version)
+		}
+	}
 }
 
 // sendClientsRequest solicita ao servidor o snapshot completo dos clientes.
@@ -36,74 +144,117 @@ func sendClientsRequest(conn net.Conn) error {
 		Data: protocol.ClientsRequestData{},
 	}
 
-	payload, err := json.Marshal(msg)
-	if err != nil {
-		return err
-	}
-
-	_, err = conn.Write(append(payload, '\n'))
-	return err
+	return writeMessage(conn, msg)
 }
 
 // sendIntervalSetRequest pede para o servidor reajustar o intervalo de métricas.
 func sendIntervalSetRequest(conn net.Conn, clientID string, intervalMs int64) error {
 	msg := protocol.Message{
 		Type: "interval_set_request",
+		ID:   newMessageID(),
 		Data: protocol.IntervalUpdateData{
 			ClientID:   clientID,
 			IntervalMs: intervalMs,
 		},
 	}
 
-	payload, err := json.Marshal(msg)
-	if err != nil {
-		return err
+	return writeMessage(conn, msg)
+}
+
+// sendHistoryRequest pede ao servidor a série histórica de uma métrica do cliente.
+func sendHistoryRequest(conn net.Conn, clientID, metric string, from, to time.Time, step time.Duration) error {
+	msg := protocol.Message{
+		Type: "history_request",
+		ID:   newMessageID(),
+		Data: protocol.HistoryRequestData{
+			ClientID:    clientID,
+			Metric:      metric,
+			From:        from,
+			To:          to,
+			StepMs:      step.Milliseconds(),
+			Aggregation: "avg",
+		},
 	}
 
-	_, err = conn.Write(append(payload, '\n'))
-	return err
+	return writeMessage(conn, msg)
+}
+
+// sendAlertAck reconhece um alerta ativo em nome deste monitor.
+func sendAlertAck(conn net.Conn, alertID string) error {
+	msg := protocol.Message{
+		Type: "alert_ack",
+		ID:   newMessageID(),
+		Data: protocol.AlertAckData{AlertID: alertID},
+	}
+
+	return writeMessage(conn, msg)
 }
 
 // listenServer fica lendo a conexão e roteando mensagens para os canais corretos.
-func listenServer(conn net.Conn, snapshots chan<- []protocol.ClientStateSummary, updates chan<- protocol.ClientStateSummary, removals chan<- string, errs chan<- error) {
-	reader := bufio.NewReader(conn)
+// Com idle positivo (o servidor envia pings), um servidor mudo por esse tempo
+// é dado como perdido.
+func listenServer(conn net.Conn, reader *bufio.Reader, idle time.Duration, events serverEvents) {
 	for {
+		if idle > 0 {
+			if err := conn.SetReadDeadline(time.Now().Add(idle)); err != nil {
+				events.errs <- err
+				return
+			}
+		}
+
 		line, err := reader.ReadBytes('\n')
 		if err != nil {
-			errs <- err
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				err = fmt.Errorf("nenhum sinal do servidor em %s", idle)
+			}
+			events.errs <- err
 			return
 		}
 
-		var msg protocol.Message
-		if err := json.Unmarshal(line, &msg); err != nil {
+		msg, err := protocol.Decode(line)
+		if errors.Is(err, protocol.ErrUnknownType) {
+			// mensagens desconhecidas são ignoradas
+			continue
+		}
+		if err != nil {
 			fmt.Println("❌ Erro ao decodificar mensagem do servidor:", err)
 			continue
 		}
 
 		switch msg.Type {
-		case "clients_state":
-			var data protocol.ClientsStateData
-			if err := utils.ParseData(msg.Data, &data); err != nil {
-				fmt.Println("❌ Erro ao interpretar clients_state:", err)
-				continue
+		case "ping":
+			data := msg.Data.(*protocol.HeartbeatData)
+			if err := writeMessage(conn, protocol.Message{Type: "pong", Data: *data}); err != nil {
+				fmt.Println("❌ Erro ao responder ping do servidor:", err)
 			}
-			snapshots <- data.Clients
+		case "clients_state":
+			data := msg.Data.(*protocol.ClientsStateData)
+			events.snapshots <- data.Clients
 		case "client_update":
-			var data protocol.ClientUpdateData
-			if err := utils.ParseData(msg.Data, &data); err != nil {
-				fmt.Println("❌ Erro ao interpretar client_update:", err)
-				continue
-			}
-			updates <- data.Client
+			data := msg.Data.(*protocol.ClientUpdateData)
+			events.updates <- data.Client
 		case "client_removed":
-			var data protocol.ClientRemovedData
-			if err := utils.ParseData(msg.Data, &data); err != nil {
-				fmt.Println("❌ Erro ao interpretar client_removed:", err)
-				continue
-			}
-			removals <- data.ClientID
-		default:
-			// mensagens desconhecidas são ignoradas
+			data := msg.Data.(*protocol.ClientRemovedData)
+			events.removals <- data.ClientID
+		case "history_response":
+			data := msg.Data.(*protocol.HistoryResponseData)
+			events.history <- *data
+		case "alerts_state":
+			data := msg.Data.(*protocol.AlertsStateData)
+			events.alerts <- data.Alerts
+		case "alert":
+			data := msg.Data.(*protocol.AlertData)
+			events.alert <- *data
+		case "error":
+			data := msg.Data.(*protocol.ErrorData)
+			events.failures <- *data
+		case "server_shutdown":
+			// O servidor espera que os pares desconectem por conta própria.
+			data := msg.Data.(*protocol.ServerShutdownData)
+			events.shutdown <- *data
+			conn.Close()
+			return
 		}
 	}
 }
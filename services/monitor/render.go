@@ -2,8 +2,10 @@ package main
 
 import (
 	"fmt"
+	"libs/protocol"
 	"math"
 	"strings"
+	"time"
 
 	"github.com/mattn/go-runewidth"
 )
@@ -50,6 +52,42 @@ func humanBytes(v uint64) string {
 	return fmt.Sprintf("%.2f%cB", value, "KMGTPE"[exp])
 }
 
+// humanRate formata uma taxa em bytes por segundo.
+func humanRate(v float64) string {
+	if v < 0 {
+		v = 0
+	}
+	return humanBytes(uint64(math.Round(v))) + "/s"
+}
+
+// formatUptime descreve há quanto tempo a máquina está ligada, de forma curta
+// (ex.: "3d4h", "5h12m", "7m").
+func formatUptime(boot time.Time) string {
+	up := time.Since(boot)
+	if up < 0 {
+		up = 0
+	}
+	days := int(up.Hours()) / 24
+	hours := int(up.Hours()) % 24
+	minutes := int(up.Minutes()) % 60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd%dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
+
+// colorForLoad colore a média de carga conforme a ocupação dos núcleos lógicos.
+func colorForLoad(load float64, cores int) string {
+	if cores <= 0 {
+		cores = 1
+	}
+	return colorForUsage(load / float64(cores) * 100)
+}
+
 // coloredBar cria uma barra horizontal colorida para uso em textos.
 func coloredBar(value float64, width int) string {
 	if width <= 0 {
@@ -103,6 +141,33 @@ func colorForUsage(value float64) string {
 	}
 }
 
+// colorForSeverity escolhe a cor usada para cada severidade de alerta.
+func colorForSeverity(severity string) string {
+	switch severity {
+	case "critical":
+		return "#ff5555"
+	case "warning":
+		return "#ffb86c"
+	default:
+		return "#8be9fd"
+	}
+}
+
+// healthBadge devolve um marcador colorido e o rótulo da saúde do cliente.
+// Servidores antigos não informam a saúde e recebem um marcador neutro.
+func healthBadge(health string) (string, string) {
+	switch health {
+	case protocol.HealthHealthy:
+		return "[#50fa7b]●[-]", "saudável"
+	case protocol.HealthLate:
+		return "[#ffb86c]●[-]", "atrasado"
+	case protocol.HealthStale:
+		return "[#ff5555]●[-]", "sem resposta"
+	default:
+		return "[gray]○[-]", "desconhecido"
+	}
+}
+
 // labelledHeatmapLines cria linhas com mapa de calor e título alinhado.
 func labelledHeatmapLines(title string, values []float64, width, height int) []string {
 	lines := renderHeatmapLines(values, width, height)
@@ -115,6 +180,23 @@ func labelledHeatmapLines(title string, values []float64, width, height int) []s
 	return lines
 }
 
+// scaleToPeak converte uma série sem limite fixo (como bytes/s) em
+// porcentagens do maior valor, para reaproveitar o heatmap; devolve também o pico.
+func scaleToPeak(values []float64) ([]float64, float64) {
+	peak := 0.0
+	for _, v := range values {
+		peak = math.Max(peak, v)
+	}
+	scaled := make([]float64, len(values))
+	if peak <= 0 {
+		return scaled, 0
+	}
+	for i, v := range values {
+		scaled[i] = v / peak * 100
+	}
+	return scaled, peak
+}
+
 // renderHeatmapLines converte uma série em blocos coloridos estilo heatmap.
 func renderHeatmapLines(values []float64, width, height int) []string {
 	if len(values) == 0 || height <= 0 {
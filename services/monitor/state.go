@@ -2,7 +2,9 @@ package main
 
 import (
 	"libs/protocol"
+	"reflect"
 	"sort"
+	"time"
 )
 
 const historyCapacity = 60
@@ -12,12 +14,20 @@ type monitorState struct {
 	clients map[string]protocol.ClientStateSummary
 	order   []string
 	history map[string]*statsHistory
+	alerts  map[string]protocol.AlertData
 }
 
 // statsHistory guarda séries históricas usadas para os gráficos de calor.
 type statsHistory struct {
 	CPU    []float64
 	Memory []float64
+	// Network guarda o tráfego total (entrada + saída) em bytes/s.
+	Network []float64
+	// Since marca o instante (relógio do servidor) da primeira amostra ao vivo,
+	// servindo de limite superior para o preenchimento vindo do histórico.
+	Since time.Time
+	// BackfillRequested evita pedir o histórico mais de uma vez por cliente.
+	BackfillRequested bool
 }
 
 // newMonitorState cria uma instância pronta para uso do estado compartilhado.
@@ -26,6 +36,7 @@ func newMonitorState() monitorState {
 		clients: make(map[string]protocol.ClientStateSummary),
 		order:   []string{},
 		history: make(map[string]*statsHistory),
+		alerts:  make(map[string]protocol.AlertData),
 	}
 }
 
@@ -48,7 +59,7 @@ func (s *monitorState) applySnapshot(list []protocol.ClientStateSummary) {
 		newClients[id] = item
 		newOrder = append(newOrder, id)
 		active[id] = struct{}{}
-		s.appendMetrics(id, item)
+		s.appendMetrics(id, s.clients[id], item)
 	}
 
 	sort.Strings(newOrder)
@@ -65,13 +76,14 @@ func (s *monitorState) applySnapshot(list []protocol.ClientStateSummary) {
 // applyUpdate injeta novas métricas incrementais para um cliente específico.
 func (s *monitorState) applyUpdate(summary protocol.ClientStateSummary) {
 	id := clientKey(summary)
-	if _, exists := s.clients[id]; !exists {
+	previous, exists := s.clients[id]
+	if !exists {
 		s.order = append(s.order, id)
 		sort.Strings(s.order)
 	}
 
 	s.clients[id] = summary
-	s.appendMetrics(id, summary)
+	s.appendMetrics(id, previous, summary)
 }
 
 // applyRemoval remove as informações de um cliente desconectado.
@@ -90,15 +102,59 @@ func (s *monitorState) applyRemoval(clientID string) {
 	delete(s.history, clientID)
 }
 
-// appendMetrics atualiza as séries históricas com os novos valores.
-func (s *monitorState) appendMetrics(id string, summary protocol.ClientStateSummary) {
+// appendMetrics atualiza as séries históricas com os novos valores. Como o
+// servidor envia um client_update para cada métrica recebida, só acrescenta
+// pontos quando a métrica correspondente realmente mudou.
+func (s *monitorState) appendMetrics(id string, previous, summary protocol.ClientStateSummary) {
 	h := s.ensureHistory(id)
-	if summary.CPU != nil {
+	if h.Since.IsZero() && !summary.LastUpdate.IsZero() {
+		h.Since = summary.LastUpdate
+	}
+	if summary.CPU != nil && !reflect.DeepEqual(previous.CPU, summary.CPU) {
 		h.CPU = appendValue(h.CPU, summary.CPU.Usage)
 	}
-	if summary.Memory != nil {
+	if summary.Memory != nil && !reflect.DeepEqual(previous.Memory, summary.Memory) {
 		h.Memory = appendValue(h.Memory, summary.Memory.UsedPercent)
 	}
+	if summary.Network != nil && !reflect.DeepEqual(previous.Network, summary.Network) {
+		h.Network = appendValue(h.Network, networkThroughput(summary.Network))
+	}
+}
+
+// applyHistory antepõe os pontos vindos do histórico do servidor às amostras
+// recebidas ao vivo, respeitando a capacidade da série.
+func (s *monitorState) applyHistory(resp protocol.HistoryResponseData) {
+	h, ok := s.history[resp.ClientID]
+	if !ok || resp.Error != "" {
+		return
+	}
+
+	values := make([]float64, 0, len(resp.Points))
+	for _, p := range resp.Points {
+		if !h.Since.IsZero() && !p.Timestamp.Before(h.Since) {
+			continue
+		}
+		values = append(values, p.Value)
+	}
+
+	switch resp.Metric {
+	case "cpu_usage":
+		h.CPU = prependValues(values, h.CPU)
+	case "memory_usage":
+		h.Memory = prependValues(values, h.Memory)
+	case "network_usage":
+		h.Network = prependValues(values, h.Network)
+	}
+}
+
+// networkThroughput soma entrada e saída de todas as interfaces, o mesmo
+// valor que o servidor guarda no campo padrão (bytes_per_sec) do histórico.
+func networkThroughput(network *protocol.NetworkUsageData) float64 {
+	var total float64
+	for _, iface := range network.Interfaces {
+		total += iface.BytesInPerSec + iface.BytesOutPerSec
+	}
+	return total
 }
 
 // ensureHistory devolve (criando se necessário) a série histórica de um cliente.
@@ -123,3 +179,61 @@ func appendValue(values []float64, v float64) []float64 {
 }
 
 // Código gerado com auxílio de IA.
+
+// prependValues coloca pontos antigos antes da série atual, descartando os
+// mais antigos quando a capacidade é excedida.
+func prependValues(older, current []float64) []float64 {
+	merged := append(append([]float64(nil), older...), current...)
+	if len(merged) > historyCapacity {
+		merged = merged[len(merged)-historyCapacity:]
+	}
+	return merged
+}
+
+// applyAlertsSnapshot substitui a lista de alertas ativos pela enviada pelo servidor.
+func (s *monitorState) applyAlertsSnapshot(list []protocol.AlertData) {
+	s.alerts = make(map[string]protocol.AlertData, len(list))
+	for _, alert := range list {
+		s.applyAlert(alert)
+	}
+}
+
+// applyAlert registra uma transição de alerta, descartando os resolvidos e os
+// cancelados (pendentes que nunca dispararam).
+func (s *monitorState) applyAlert(alert protocol.AlertData) {
+	if alert.State == "resolved" || alert.State == "cancelled" {
+		delete(s.alerts, alert.ID)
+		return
+	}
+	s.alerts[alert.ID] = alert
+}
+
+// sortedAlerts devolve os alertas agrupados por cliente e ordenados por severidade.
+func (s *monitorState) sortedAlerts() []protocol.AlertData {
+	list := make([]protocol.AlertData, 0, len(s.alerts))
+	for _, alert := range s.alerts {
+		list = append(list, alert)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].ClientID != list[j].ClientID {
+			return list[i].ClientID < list[j].ClientID
+		}
+		if ri, rj := severityRank(list[i].Severity), severityRank(list[j].Severity); ri != rj {
+			return ri > rj
+		}
+		return list[i].StartsAt.Before(list[j].StartsAt)
+	})
+	return list
+}
+
+// severityRank ordena as severidades da mais branda para a mais grave.
+func severityRank(severity string) int {
+	switch severity {
+	case "critical":
+		return 2
+	case "warning":
+		return 1
+	default:
+		return 0
+	}
+}
@@ -21,16 +21,18 @@ const (
 type monitorUI struct {
 	app       *tview.Application
 	list      *tview.List
+	alerts    *tview.List
 	details   *tview.TextView
 	status    *tview.TextView
 	state     monitorState
 	selected  string
 	conn      net.Conn
+	server    protocol.HandshakeAckData
 	lastError error
 }
 
 // newMonitorUI monta a estrutura visual e callbacks básicos da aplicação.
-func newMonitorUI(app *tview.Application, conn net.Conn) *monitorUI {
+func newMonitorUI(app *tview.Application, conn net.Conn, server protocol.HandshakeAckData) *monitorUI {
 	list := tview.NewList()
 	list.ShowSecondaryText(true)
 	list.SetWrapAround(true)
@@ -38,6 +40,13 @@ func newMonitorUI(app *tview.Application, conn net.Conn) *monitorUI {
 	list.SetTitle(" Clientes ")
 	list.SetHighlightFullLine(true)
 
+	alerts := tview.NewList()
+	alerts.ShowSecondaryText(true)
+	alerts.SetWrapAround(true)
+	alerts.SetBorder(true)
+	alerts.SetTitle(" Alertas ")
+	alerts.SetHighlightFullLine(true)
+
 	details := tview.NewTextView()
 	details.SetDynamicColors(true)
 	details.SetWrap(true)
@@ -54,10 +63,12 @@ func newMonitorUI(app *tview.Application, conn net.Conn) *monitorUI {
 	ui := &monitorUI{
 		app:     app,
 		list:    list,
+		alerts:  alerts,
 		details: details,
 		status:  status,
 		state:   newMonitorState(),
 		conn:    conn,
+		server:  server,
 	}
 
 	list.SetChangedFunc(func(index int, mainText string, secondary string, shortcut rune) {
@@ -68,6 +79,14 @@ func newMonitorUI(app *tview.Application, conn net.Conn) *monitorUI {
 		app.Stop()
 	})
 
+	alerts.SetSelectedFunc(func(index int, mainText string, secondary string, shortcut rune) {
+		ui.focusAlertClient(index)
+	})
+
+	alerts.SetDoneFunc(func() {
+		app.Stop()
+	})
+
 	return ui
 }
 
@@ -80,6 +99,7 @@ func (ui *monitorUI) layout() tview.Primitive {
 
 	mainFlex := tview.NewFlex().
 		AddItem(ui.list, 32, 0, true).
+		AddItem(ui.alerts, 36, 0, false).
 		AddItem(ui.details, 0, 1, false)
 
 	root := tview.NewFlex().
@@ -102,7 +122,8 @@ func (ui *monitorUI) refreshList() {
 		if !client.LastUpdate.IsZero() {
 			elapsed = time.Since(client.LastUpdate).Round(time.Second).String()
 		}
-		ui.list.AddItem(name, fmt.Sprintf("%s | Atualizado há %s", client.RemoteAddr, elapsed), 0, nil)
+		badge, health := healthBadge(client.Health)
+		ui.list.AddItem(badge+" "+name, fmt.Sprintf("%s | Atualizado há %s | %s", hostSummary(client), elapsed, health), 0, nil)
 	}
 
 	if len(ui.state.order) == 0 {
@@ -125,6 +146,115 @@ func (ui *monitorUI) refreshList() {
 	ui.selectIndex(index)
 }
 
+// refreshAlerts redesenha o painel de alertas mantendo o item destacado.
+func (ui *monitorUI) refreshAlerts() {
+	currentID := ui.selectedAlertID()
+	alerts := ui.state.sortedAlerts()
+
+	ui.alerts.Clear()
+	if !ui.server.Supports(protocol.FeatureAlerts) {
+		ui.alerts.SetTitle(" Alertas ")
+		ui.alerts.AddItem("[gray]Não suportado pelo servidor[-]", "", 0, nil)
+		return
+	}
+	ui.alerts.SetTitle(fmt.Sprintf(" Alertas (%d) ", len(alerts)))
+	if len(alerts) == 0 {
+		ui.alerts.AddItem("[green]Nenhum alerta ativo[-]", "", 0, nil)
+		return
+	}
+
+	index := 0
+	for idx, alert := range alerts {
+		ui.alerts.AddItem(alertMainText(alert), alertSecondaryText(alert), 0, nil)
+		if alert.ID == currentID {
+			index = idx
+		}
+	}
+	ui.alerts.SetCurrentItem(index)
+}
+
+// selectedAlertID devolve o alerta destacado no painel, se houver.
+func (ui *monitorUI) selectedAlertID() string {
+	alerts := ui.state.sortedAlerts()
+	index := ui.alerts.GetCurrentItem()
+	if index < 0 || index >= len(alerts) {
+		return ""
+	}
+	return alerts[index].ID
+}
+
+// acknowledgeSelectedAlert envia o reconhecimento do alerta destacado.
+func (ui *monitorUI) acknowledgeSelectedAlert() {
+	if !ui.server.Supports(protocol.FeatureAlerts) {
+		ui.setStatus("O servidor não suporta alertas.")
+		return
+	}
+	id := ui.selectedAlertID()
+	if id == "" {
+		ui.setStatus("Nenhum alerta selecionado.")
+		return
+	}
+
+	alert := ui.state.alerts[id]
+	if alert.AckedBy != "" {
+		ui.setStatus(fmt.Sprintf("Alerta %s já reconhecido por %s.", alert.Rule, alert.AckedBy))
+		return
+	}
+
+	if err := sendAlertAck(ui.conn, id); err != nil {
+		ui.setStatus(fmt.Sprintf("[red]Erro ao reconhecer alerta: %v", err))
+		return
+	}
+	ui.setStatus(fmt.Sprintf("Reconhecimento enviado para %s (%s).", alert.Rule, alert.ClientID))
+}
+
+// focusAlertClient seleciona na lista de clientes o dono do alerta escolhido.
+func (ui *monitorUI) focusAlertClient(index int) {
+	alerts := ui.state.sortedAlerts()
+	if index < 0 || index >= len(alerts) {
+		return
+	}
+	for idx, id := range ui.state.order {
+		if id == alerts[index].ClientID {
+			ui.list.SetCurrentItem(idx)
+			ui.app.SetFocus(ui.list)
+			return
+		}
+	}
+}
+
+// toggleFocus alterna o foco entre a lista de clientes e o painel de alertas.
+func (ui *monitorUI) toggleFocus() {
+	if ui.app.GetFocus() == ui.alerts {
+		ui.app.SetFocus(ui.list)
+		return
+	}
+	ui.app.SetFocus(ui.alerts)
+}
+
+// alertMainText monta a linha principal do alerta com a cor da severidade.
+func alertMainText(alert protocol.AlertData) string {
+	color := colorForSeverity(alert.Severity)
+	if alert.AckedBy != "" {
+		color = "#6c6c6c"
+	}
+	state := "●"
+	if alert.State == "pending" {
+		state = "○"
+	}
+	return fmt.Sprintf("[%s]%s %s[-] %s · %s", color, state, strings.ToUpper(alert.Severity), alert.Rule, alert.ClientID)
+}
+
+// alertSecondaryText resume valor, tempo e reconhecimento do alerta.
+func alertSecondaryText(alert protocol.AlertData) string {
+	text := fmt.Sprintf("%.1f %s %.1f | há %s", alert.Value, alert.Operator, alert.Threshold,
+		time.Since(alert.StartsAt).Round(time.Second))
+	if alert.AckedBy != "" {
+		text += " | ✔ " + alert.AckedBy
+	}
+	return text
+}
+
 // renderDetails preenche o painel com os números e gráficos do cliente ativo.
 func (ui *monitorUI) renderDetails() {
 	if ui.selected == "" {
@@ -143,9 +273,33 @@ func (ui *monitorUI) renderDetails() {
 	if client.RemoteAddr != "" {
 		fmt.Fprintf(&b, "[yellow]Origem:[-] %s\n", client.RemoteAddr)
 	}
-	if client.General != nil {
-		fmt.Fprintf(&b, "CPU: %s | Cores: %d | %.2f MHz\n",
-			client.General.ModelName, client.General.Cores, client.General.Mhz)
+	if g := client.General; g != nil {
+		if g.Hostname != "" {
+			fmt.Fprintf(&b, "[yellow]Host:[-] %s | %s %s | kernel %s (%s)", g.Hostname, g.Platform, g.PlatformVersion, g.KernelVersion, g.KernelArch)
+			if !g.BootTime.IsZero() {
+				fmt.Fprintf(&b, " | ligado há %s", formatUptime(g.BootTime))
+			}
+			b.WriteString("\n")
+		}
+		if g.LogicalCores > 0 {
+			fmt.Fprintf(&b, "CPU: %s | %d núcleos lógicos, %d físicos | %.2f MHz\n", g.ModelName, g.LogicalCores, g.PhysicalCores, g.Mhz)
+		} else {
+			fmt.Fprintf(&b, "CPU: %s | Cores: %d | %.2f MHz\n", g.ModelName, g.Cores, g.Mhz)
+		}
+	}
+	if load := client.Load; load != nil {
+		cores := 0
+		if client.General != nil {
+			cores = client.General.LogicalCores
+		}
+		if cores == 0 && client.CPU != nil {
+			cores = len(client.CPU.CoresUsage)
+		}
+		fmt.Fprintf(&b, "[yellow]Carga:[-] [%s]%.2f[-] %.2f %.2f (1/5/15 min) | Swap: %s %5.1f%% (%s / %s)\n",
+			colorForLoad(load.Load1, cores), load.Load1, load.Load5, load.Load15,
+			coloredBar(load.SwapUsedPercent, 10), load.SwapUsedPercent, humanBytes(load.SwapUsed), humanBytes(load.SwapTotal))
+		fmt.Fprintf(&b, "Trocas de contexto: %.0f/s | Processos: %d executando, %d bloqueados\n",
+			load.ContextSwitchesPerSec, load.ProcsRunning, load.ProcsBlocked)
 	}
 
 	sections := make([]string, 0, 3)
@@ -170,7 +324,7 @@ func (ui *monitorUI) renderDetails() {
 			humanBytes(client.Memory.Used),
 			humanBytes(client.Memory.Total)))
 	}
-	if client.Disk != nil {
+	if client.Disk != nil && len(client.Disk.Mounts) == 0 {
 		memInfo = append(memInfo, fmt.Sprintf("[yellow]Disco:[-] %s %5.1f%% (%s / %s)",
 			coloredBar(client.Disk.UsedPercent, 20),
 			client.Disk.UsedPercent,
@@ -180,6 +334,18 @@ func (ui *monitorUI) renderDetails() {
 	if client.StatsIntervalMs > 0 {
 		memInfo = append(memInfo, fmt.Sprintf("[yellow]Intervalo de envio:[-] %d ms", client.StatsIntervalMs))
 	}
+	if client.Health != "" {
+		badge, health := healthBadge(client.Health)
+		memInfo = append(memInfo, fmt.Sprintf("[yellow]Saúde:[-] %s %s", badge, health))
+	}
+	if seq := client.Sequence; seq != nil {
+		color := "green"
+		if seq.Missing > 0 || seq.Duplicates > 0 {
+			color = "red"
+		}
+		memInfo = append(memInfo, fmt.Sprintf("[yellow]Mensagens:[-] %d recebidas | [%s]%d perdidas, %d duplicadas[-] (seq %d)",
+			seq.Received, color, seq.Missing, seq.Duplicates, seq.LastSeq))
+	}
 	if len(memInfo) > 0 {
 		var heat []string
 		if hist, ok := ui.state.history[ui.selected]; ok {
@@ -188,6 +354,24 @@ func (ui *monitorUI) renderDetails() {
 		sections = append(sections, mergeColumns(heat, memInfo, "   "))
 	}
 
+	if diskInfo := diskLines(client); len(diskInfo) > 0 {
+		sections = append(sections, strings.Join(diskInfo, "\n"))
+	}
+
+	if network := client.Network; network != nil {
+		netInfo := []string{fmt.Sprintf("[yellow]Rede:[-] ↓ %s  ↑ %s",
+			humanRate(networkTotalIn(network)), humanRate(networkTotalOut(network)))}
+		for _, iface := range network.Interfaces {
+			netInfo = append(netInfo, networkInterfaceLine(iface))
+		}
+		var heat []string
+		if hist, ok := ui.state.history[ui.selected]; ok {
+			scaled, peak := scaleToPeak(hist.Network)
+			heat = labelledHeatmapLines(fmt.Sprintf("Rede (pico %s)", humanRate(peak)), scaled, 26, 6)
+		}
+		sections = append(sections, mergeColumns(heat, netInfo, "   "))
+	}
+
 	if len(sections) > 0 {
 		fmt.Fprintf(&b, "\n%s\n", strings.Join(sections, "\n\n"))
 	}
@@ -208,6 +392,62 @@ func (ui *monitorUI) renderDetails() {
 	ui.details.SetText(b.String())
 }
 
+// diskLines lista o uso de espaço e inodes de cada ponto de montagem e as
+// taxas de E/S de cada dispositivo, quando o agente os envia.
+func diskLines(client protocol.ClientStateSummary) []string {
+	var lines []string
+	if client.Disk != nil && len(client.Disk.Mounts) > 0 {
+		lines = append(lines, "[yellow]Discos:[-]")
+		for _, m := range client.Disk.Mounts {
+			lines = append(lines, fmt.Sprintf(" %-16s %s %5.1f%% (%s / %s) | inodes [%s]%.1f%%[-] | %s",
+				truncate(m.Mountpoint, 16), coloredBar(m.UsedPercent, 16), m.UsedPercent,
+				humanBytes(m.Used), humanBytes(m.Total),
+				colorForUsage(m.InodesUsedPercent), m.InodesUsedPercent, m.Fstype))
+		}
+	}
+	if client.DiskIO != nil && len(client.DiskIO.Devices) > 0 {
+		lines = append(lines, "[yellow]E/S de disco:[-]")
+		for _, d := range client.DiskIO.Devices {
+			lines = append(lines, fmt.Sprintf(" %-10s leitura %10s (%.0f op/s) | escrita %10s (%.0f op/s) | ocupado [%s]%.1f%%[-]",
+				truncate(d.Name, 10), humanRate(d.ReadBytesPerSec), d.ReadsPerSec,
+				humanRate(d.WriteBytesPerSec), d.WritesPerSec, colorForUsage(d.BusyPercent), d.BusyPercent))
+		}
+	}
+	return lines
+}
+
+// networkInterfaceLine resume as taxas de uma interface, destacando erros e
+// descartes quando existem.
+func networkInterfaceLine(iface protocol.NetworkInterfaceUsage) string {
+	errorRate := iface.ErrorsInPerSec + iface.ErrorsOutPerSec
+	dropRate := iface.DropsInPerSec + iface.DropsOutPerSec
+	color := "green"
+	if errorRate > 0 || dropRate > 0 {
+		color = "red"
+	}
+	return fmt.Sprintf("%-10s ↓ %10s ↑ %10s | pkts ↓ %.0f/s ↑ %.0f/s | [%s]erros %.1f/s, descartes %.1f/s[-]",
+		truncate(iface.Name, 10), humanRate(iface.BytesInPerSec), humanRate(iface.BytesOutPerSec),
+		iface.PacketsInPerSec, iface.PacketsOutPerSec, color, errorRate, dropRate)
+}
+
+// networkTotalIn soma o tráfego de entrada de todas as interfaces.
+func networkTotalIn(network *protocol.NetworkUsageData) float64 {
+	var total float64
+	for _, iface := range network.Interfaces {
+		total += iface.BytesInPerSec
+	}
+	return total
+}
+
+// networkTotalOut soma o tráfego de saída de todas as interfaces.
+func networkTotalOut(network *protocol.NetworkUsageData) float64 {
+	var total float64
+	for _, iface := range network.Interfaces {
+		total += iface.BytesOutPerSec
+	}
+	return total
+}
+
 // selectIndex movimenta a seleção e refaz o painel de detalhes.
 func (ui *monitorUI) selectIndex(index int) {
 	if index < 0 || index >= len(ui.state.order) {
@@ -216,9 +456,61 @@ func (ui *monitorUI) selectIndex(index int) {
 		return
 	}
 	ui.selected = ui.state.order[index]
+	ui.requestBackfill(ui.selected)
 	ui.renderDetails()
 }
 
+// requestBackfill pede ao servidor o histórico anterior à primeira amostra ao
+// vivo, para que os gráficos não comecem vazios ao abrir o monitor.
+func (ui *monitorUI) requestBackfill(id string) {
+	if !ui.server.Supports(protocol.FeatureHistory) {
+		return
+	}
+	client, ok := ui.state.clients[id]
+	if !ok {
+		return
+	}
+	h := ui.state.ensureHistory(id)
+	if h.BackfillRequested || h.Since.IsZero() {
+		return
+	}
+	h.BackfillRequested = true
+
+	step := time.Duration(client.StatsIntervalMs) * time.Millisecond
+	if step <= 0 {
+		step = 5 * time.Second
+	}
+	from := h.Since.Add(-historyCapacity * step)
+
+	clientID := clientIDFromSummary(client)
+	for _, metric := range []string{"cpu_usage", "memory_usage", "network_usage"} {
+		if err := sendHistoryRequest(ui.conn, clientID, metric, from, h.Since, step); err != nil {
+			ui.setStatus(fmt.Sprintf("[red]Erro ao solicitar histórico: %v", err))
+			return
+		}
+	}
+}
+
+// commandLabels descreve, para o rodapé, os comandos que o servidor pode recusar.
+var commandLabels = map[string]string{
+	"interval_set_request": "alteração de intervalo",
+	"alert_ack":            "reconhecimento de alerta",
+	"history_request":      "pedido de histórico",
+	"clients_request":      "pedido de snapshot",
+}
+
+// showServerError exibe no rodapé um erro reportado pelo servidor.
+func (ui *monitorUI) showServerError(failure protocol.ErrorData) {
+	command, ok := commandLabels[failure.RefType]
+	if !ok {
+		command = failure.RefType
+	}
+	if command == "" {
+		command = "mensagem"
+	}
+	ui.setStatus(fmt.Sprintf("[red]Servidor recusou %s (%s): %s", command, failure.Code, failure.Message))
+}
+
 // setStatus escreve uma mensagem no rodapé da interface.
 func (ui *monitorUI) setStatus(msg string) {
 	ui.status.SetText(msg)
@@ -272,6 +564,19 @@ func (ui *monitorUI) changeSelectedInterval(deltaMs int64) {
 	ui.setStatus(fmt.Sprintf("Solicitado novo intervalo (%d ms) para %s", newValue, displayName(client)))
 }
 
+// hostSummary resume a máquina do cliente para a lista: hostname e tempo
+// ligado quando o agente os envia, senão o endereço remoto.
+func hostSummary(client protocol.ClientStateSummary) string {
+	g := client.General
+	if g == nil || g.Hostname == "" {
+		return client.RemoteAddr
+	}
+	if g.BootTime.IsZero() {
+		return g.Hostname
+	}
+	return fmt.Sprintf("%s | ligado há %s", g.Hostname, formatUptime(g.BootTime))
+}
+
 // displayName decide qual identificador deve aparecer na UI.
 func displayName(client protocol.ClientStateSummary) string {
 	if client.Handshake != nil && client.Handshake.ClientID != "" {
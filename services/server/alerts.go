@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"libs/protocol"
+	"os"
+	"sync"
+	"time"
+)
+
+// Alert lifecycle states broadcast to monitors. A pending alert whose
+// condition clears before it fires is cancelled rather than resolved.
+const (
+	alertPending   = "pending"
+	alertFiring    = "firing"
+	alertResolved  = "resolved"
+	alertCancelled = "cancelled"
+)
+
+// alertRule is a threshold condition evaluated against every client update.
+// Rules are loaded from a JSON array at startup, for example:
+//
+//	{"name": "high_cpu", "metric": "cpu_usage", "field": "usage",
+//	 "op": ">", "threshold": 90, "for": "2m", "severity": "critical"}
+type alertRule struct {
+	Name      string  `json:"name"`
+	Metric    string  `json:"metric"`
+	Field     string  `json:"field,omitempty"`
+	Op        string  `json:"op"`
+	Threshold float64 `json:"threshold"`
+	For       string  `json:"for,omitempty"`
+	Severity  string  `json:"severity,omitempty"`
+
+	forDuration time.Duration
+}
+
+var (
+	alertsMu     sync.Mutex
+	alertRules   []alertRule
+	activeAlerts = make(map[string]*protocol.AlertData)
+)
+
+// loadAlertRules reads and validates the rules file, filling in defaults.
+func loadAlertRules(path string) ([]alertRule, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []alertRule
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool, len(rules))
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule #%d: name is required", i+1)
+		}
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("rule %s: duplicated name", rule.Name)
+		}
+		seen[rule.Name] = true
+
+		field, err := resolveMetricField(rule.Metric, rule.Field)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		rule.Field = field
+
+		switch rule.Op {
+		case ">", ">=", "<", "<=":
+		default:
+			return nil, fmt.Errorf("rule %s: unknown operator %q", rule.Name, rule.Op)
+		}
+
+		if rule.For != "" {
+			d, err := time.ParseDuration(rule.For)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("rule %s: invalid duration %q", rule.Name, rule.For)
+			}
+			rule.forDuration = d
+		}
+
+		switch rule.Severity {
+		case "":
+			rule.Severity = "warning"
+		case "info", "warning", "critical":
+		default:
+			return nil, fmt.Errorf("rule %s: unknown severity %q", rule.Name, rule.Severity)
+		}
+	}
+
+	return rules, nil
+}
+
+// setAlertRules installs the rules evaluated by evaluateAlerts.
+func setAlertRules(rules []alertRule) {
+	alertsMu.Lock()
+	defer alertsMu.Unlock()
+	alertRules = rules
+}
+
+// matches applies the rule operator to a sampled value.
+func (r alertRule) matches(value float64) bool {
+	switch r.Op {
+	case ">":
+		return value > r.Threshold
+	case ">=":
+		return value >= r.Threshold
+	case "<":
+		return value < r.Threshold
+	case "<=":
+		return value <= r.Threshold
+	}
+	return false
+}
+
+// evaluateAlerts checks every rule against the latest state of a client and
+// broadcasts the alerts whose state changed.
+func evaluateAlerts(state *ClientState) {
+	for _, alert := range applyAlertRules(state, time.Now()) {
+		logAlert(alert)
+		broadcastAlert(alert)
+	}
+}
+
+// applyAlertRules advances the alerts of a client as of now and returns the
+// ones whose state changed: a matching rule opens a pending alert, which fires
+// once it held for the rule's duration; an alert whose condition clears is
+// closed (see closeAlert), so the next match starts over as pending.
+func applyAlertRules(state *ClientState, now time.Time) []protocol.AlertData {
+	if state == nil || state.Handshake == nil || state.Handshake.Role != "client" {
+		return nil
+	}
+
+	summary := makeClientSummary(state)
+	clientID := summary.Handshake.ClientID
+
+	var changed []protocol.AlertData
+
+	alertsMu.Lock()
+	defer alertsMu.Unlock()
+	for _, rule := range alertRules {
+		payload := currentMetric(summary, rule.Metric)
+		if payload == nil {
+			continue
+		}
+		value, ok := metricValue(rule.Metric, rule.Field, payload)
+		if !ok {
+			continue
+		}
+
+		key := rule.Name + "/" + clientID
+		alert, active := activeAlerts[key]
+
+		if !rule.matches(value) {
+			if active {
+				alert.Value = value
+				closeAlert(alert, fmt.Sprintf("%s %s = %.2f no longer %s %.2f", rule.Metric, rule.Field, value, rule.Op, rule.Threshold), now)
+				changed = append(changed, *alert)
+				delete(activeAlerts, key)
+			}
+			continue
+		}
+
+		if !active {
+			alert = &protocol.AlertData{
+				ID:        fmt.Sprintf("%s:%s:%d", rule.Name, clientID, now.UnixMilli()),
+				Rule:      rule.Name,
+				ClientID:  clientID,
+				Metric:    rule.Metric,
+				Field:     rule.Field,
+				Operator:  rule.Op,
+				Threshold: rule.Threshold,
+				Severity:  rule.Severity,
+				State:     alertPending,
+				StartsAt:  now,
+			}
+			activeAlerts[key] = alert
+		}
+
+		alert.Value = value
+		alert.Message = fmt.Sprintf("%s %s = %.2f %s %.2f", rule.Metric, rule.Field, value, rule.Op, rule.Threshold)
+
+		if !active || (alert.State == alertPending && now.Sub(alert.StartsAt) >= rule.forDuration) {
+			if now.Sub(alert.StartsAt) >= rule.forDuration {
+				alert.State = alertFiring
+				alert.FiredAt = now
+			}
+			alert.UpdatedAt = now
+			changed = append(changed, *alert)
+		}
+	}
+	return changed
+}
+
+// resolveClientAlerts closes every active alert of a client that went away.
+func resolveClientAlerts(clientID string) {
+	if clientID == "" {
+		return
+	}
+
+	now := time.Now()
+	var closed []protocol.AlertData
+
+	alertsMu.Lock()
+	for key, alert := range activeAlerts {
+		if alert.ClientID != clientID {
+			continue
+		}
+		closeAlert(alert, "client disconnected", now)
+		closed = append(closed, *alert)
+		delete(activeAlerts, key)
+	}
+	alertsMu.Unlock()
+
+	for _, alert := range closed {
+		logAlert(alert)
+		broadcastAlert(alert)
+	}
+}
+
+// closeAlert ends an active alert. Only alerts that reached firing are
+// resolved; a pending one is cancelled so monitors drop it without reporting
+// an alert that never fired.
+func closeAlert(alert *protocol.AlertData, message string, now time.Time) {
+	if alert.State == alertPending {
+		alert.State = alertCancelled
+	} else {
+		alert.State = alertResolved
+		alert.ResolvedAt = now
+	}
+	alert.Message = message
+	alert.UpdatedAt = now
+}
+
+// acknowledgeAlert records who acknowledged an active alert and when, so every
+// monitor sees the same acknowledgement state.
+func acknowledgeAlert(alertID, by string) (protocol.AlertData, error) {
+	alertsMu.Lock()
+	defer alertsMu.Unlock()
+
+	for _, alert := range activeAlerts {
+		if alert.ID != alertID {
+			continue
+		}
+		if alert.AckedBy == "" {
+			now := time.Now()
+			alert.AckedBy = by
+			alert.AckedAt = now
+			alert.UpdatedAt = now
+		}
+		return *alert, nil
+	}
+
+	return protocol.AlertData{}, fmt.Errorf("alert %s is not active", alertID)
+}
+
+// collectActiveAlerts returns a copy of every alert that is not resolved yet.
+func collectActiveAlerts() []protocol.AlertData {
+	alertsMu.Lock()
+	defer alertsMu.Unlock()
+
+	list := make([]protocol.AlertData, 0, len(activeAlerts))
+	for _, alert := range activeAlerts {
+		list = append(list, *alert)
+	}
+	return list
+}
+
+// sendAlertsState dumps the active alerts to a single monitor.
+func sendAlertsState(mon *MonitorConn) error {
+	return mon.send(protocol.Message{
+		Type: "alerts_state",
+		Data: protocol.AlertsStateData{Alerts: collectActiveAlerts()},
+	})
+}
+
+// logAlert prints an alert transition on the server console.
+func logAlert(alert protocol.AlertData) {
+	icon := "🔔"
+	switch alert.State {
+	case alertFiring:
+		icon = "🚨"
+	case alertResolved:
+		icon = "✅"
+	case alertCancelled:
+		icon = "🔕"
+	}
+	if alert.AckedBy != "" && alert.State != alertResolved && alert.State != alertCancelled {
+		icon = "👌"
+	}
+	fmt.Printf("%s Alert %s [%s] for %s: %s (%s)\n", icon, alert.Rule, alert.State, alert.ClientID, alert.Message, alert.Severity)
+}
+
+// broadcastAlert notifies every monitor about an alert state change.
+func broadcastAlert(alert protocol.AlertData) {
+	broadcastToMonitors(protocol.Message{
+		Type: "alert",
+		Data: alert,
+	})
+}
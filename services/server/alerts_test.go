@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"libs/protocol"
+	"testing"
+	"time"
+)
+
+var alertBase = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// alertStep feeds one CPU sample at alertBase+at and lists the alert states
+// it must emit and the state left active afterwards ("" when none).
+type alertStep struct {
+	at     time.Duration
+	usage  float64
+	emits  []string
+	active string
+}
+
+// useAlertRules installs rules with no active alerts for the test's duration.
+func useAlertRules(t *testing.T, rules ...alertRule) {
+	t.Helper()
+	savedRules, savedActive := alertRules, activeAlerts
+	t.Cleanup(func() {
+		alertsMu.Lock()
+		alertRules, activeAlerts = savedRules, savedActive
+		alertsMu.Unlock()
+	})
+	alertsMu.Lock()
+	alertRules, activeAlerts = rules, make(map[string]*protocol.AlertData)
+	alertsMu.Unlock()
+}
+
+func cpuClientState(usage float64) *ClientState {
+	return &ClientState{
+		RemoteAddr: "10.0.0.9:4000",
+		Handshake:  &protocol.HandshakeData{Role: "client", ClientID: "agent"},
+		CPU:        &protocol.CpuUsageData{Usage: usage},
+	}
+}
+
+func activeAlertState(key string) string {
+	alertsMu.Lock()
+	defer alertsMu.Unlock()
+	if alert, ok := activeAlerts[key]; ok {
+		return alert.State
+	}
+	return ""
+}
+
+func TestApplyAlertRulesLifecycle(t *testing.T) {
+	tests := []struct {
+		name  string
+		hold  time.Duration
+		steps []alertStep
+	}{
+		{
+			name: "pending fires once the condition held for the duration",
+			hold: 2 * time.Minute,
+			steps: []alertStep{
+				{at: 0, usage: 95, emits: []string{alertPending}, active: alertPending},
+				{at: time.Minute, usage: 96, active: alertPending},
+				{at: 2 * time.Minute, usage: 97, emits: []string{alertFiring}, active: alertFiring},
+				{at: 3 * time.Minute, usage: 98, active: alertFiring},
+			},
+		},
+		{
+			name: "pending is cancelled when the condition clears early",
+			hold: 2 * time.Minute,
+			steps: []alertStep{
+				{at: 0, usage: 95, emits: []string{alertPending}, active: alertPending},
+				{at: time.Minute, usage: 50, emits: []string{alertCancelled}},
+				{at: 2 * time.Minute, usage: 50},
+			},
+		},
+		{
+			name: "firing is resolved when the condition clears",
+			hold: 2 * time.Minute,
+			steps: []alertStep{
+				{at: 0, usage: 95, emits: []string{alertPending}, active: alertPending},
+				{at: 2 * time.Minute, usage: 95, emits: []string{alertFiring}, active: alertFiring},
+				{at: 3 * time.Minute, usage: 50, emits: []string{alertResolved}},
+			},
+		},
+		{
+			name: "resolved alert re-arms as pending",
+			hold: 2 * time.Minute,
+			steps: []alertStep{
+				{at: 0, usage: 95, emits: []string{alertPending}, active: alertPending},
+				{at: 2 * time.Minute, usage: 95, emits: []string{alertFiring}, active: alertFiring},
+				{at: 3 * time.Minute, usage: 50, emits: []string{alertResolved}},
+				{at: 4 * time.Minute, usage: 95, emits: []string{alertPending}, active: alertPending},
+				{at: 5 * time.Minute, usage: 95, active: alertPending},
+				{at: 6 * time.Minute, usage: 95, emits: []string{alertFiring}, active: alertFiring},
+			},
+		},
+		{
+			name: "no duration fires on the first match",
+			steps: []alertStep{
+				{at: 0, usage: 95, emits: []string{alertFiring}, active: alertFiring},
+				{at: time.Minute, usage: 90, emits: []string{alertResolved}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useAlertRules(t, alertRule{
+				Name: "high_cpu", Metric: "cpu_usage", Field: "usage", Op: ">", Threshold: 90,
+				Severity: "critical", forDuration: tt.hold,
+			})
+
+			for i, step := range tt.steps {
+				now := alertBase.Add(step.at)
+				var got []string
+				for _, alert := range applyAlertRules(cpuClientState(step.usage), now) {
+					got = append(got, alert.State)
+					if alert.ClientID != "agent" || alert.Rule != "high_cpu" || alert.Value != step.usage || !alert.UpdatedAt.Equal(now) {
+						t.Fatalf("step %d: unexpected alert %+v", i, alert)
+					}
+				}
+				if fmt.Sprint(got) != fmt.Sprint(step.emits) {
+					t.Fatalf("step %d (+%s, usage %.0f): emitted %v, want %v", i, step.at, step.usage, got, step.emits)
+				}
+				if state := activeAlertState("high_cpu/agent"); state != step.active {
+					t.Fatalf("step %d: active state %q, want %q", i, state, step.active)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyAlertRulesTimestamps(t *testing.T) {
+	useAlertRules(t, alertRule{Name: "high_cpu", Metric: "cpu_usage", Field: "usage", Op: ">", Threshold: 90, forDuration: time.Minute})
+
+	pending := applyAlertRules(cpuClientState(95), alertBase)[0]
+	firing := applyAlertRules(cpuClientState(95), alertBase.Add(time.Minute))[0]
+	resolved := applyAlertRules(cpuClientState(10), alertBase.Add(2*time.Minute))[0]
+	rearmed := applyAlertRules(cpuClientState(95), alertBase.Add(3*time.Minute))[0]
+
+	if !pending.StartsAt.Equal(alertBase) || !pending.FiredAt.IsZero() {
+		t.Fatalf("pending alert = %+v", pending)
+	}
+	if firing.ID != pending.ID || !firing.StartsAt.Equal(alertBase) || !firing.FiredAt.Equal(alertBase.Add(time.Minute)) {
+		t.Fatalf("firing alert = %+v, want the pending one fired at +1m", firing)
+	}
+	if resolved.ID != pending.ID || !resolved.ResolvedAt.Equal(alertBase.Add(2*time.Minute)) {
+		t.Fatalf("resolved alert = %+v", resolved)
+	}
+	if rearmed.ID == pending.ID || !rearmed.StartsAt.Equal(alertBase.Add(3*time.Minute)) || !rearmed.ResolvedAt.IsZero() {
+		t.Fatalf("re-armed alert = %+v, want a new alert starting at +3m", rearmed)
+	}
+}
+
+func TestApplyAlertRulesCancelledHasNoResolution(t *testing.T) {
+	useAlertRules(t, alertRule{Name: "high_cpu", Metric: "cpu_usage", Field: "usage", Op: ">", Threshold: 90, forDuration: time.Minute})
+
+	applyAlertRules(cpuClientState(95), alertBase)
+	cancelled := applyAlertRules(cpuClientState(10), alertBase.Add(30*time.Second))[0]
+	if cancelled.State != alertCancelled || !cancelled.ResolvedAt.IsZero() || !cancelled.FiredAt.IsZero() {
+		t.Fatalf("cancelled alert = %+v", cancelled)
+	}
+}
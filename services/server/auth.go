@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"libs/protocol"
+	"os"
+)
+
+// Access levels granted to a connection. Monitors with read access only
+// observe; admin monitors may also change client settings.
+const (
+	accessRead  = "read"
+	accessAdmin = "admin"
+)
+
+// credential is one entry of the --auth-file JSON array, for example:
+//
+//	{"token": "shared-agent-secret", "role": "client"}
+//	{"id": "web-01", "token": "per-agent-secret", "role": "client"}
+//	{"id": "ops", "token": "monitor-secret", "role": "monitor", "access": "admin"}
+//
+// Without an id the token is a shared secret valid for any identity of the
+// role; with an id it only authenticates that client_id (or monitor name).
+type credential struct {
+	ID     string `json:"id,omitempty"`
+	Token  string `json:"token"`
+	Role   string `json:"role"`
+	Access string `json:"access,omitempty"`
+}
+
+// authCredentials is loaded once at startup; when empty, authentication is
+// disabled and every monitor gets admin access.
+var authCredentials []credential
+
+// loadCredentials reads and validates the credentials file.
+func loadCredentials(path string) ([]credential, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var creds []credential
+	if err := json.Unmarshal(raw, &creds); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	for i := range creds {
+		cred := &creds[i]
+		if cred.Token == "" {
+			return nil, fmt.Errorf("credential #%d: token is required", i+1)
+		}
+		switch cred.Role {
+		case "client":
+			cred.Access = ""
+		case "monitor":
+			switch cred.Access {
+			case "":
+				cred.Access = accessRead
+			case accessRead, accessAdmin:
+			default:
+				return nil, fmt.Errorf("credential #%d: unknown access %q", i+1, cred.Access)
+			}
+		default:
+			return nil, fmt.Errorf("credential #%d: unknown role %q", i+1, cred.Role)
+		}
+	}
+
+	return creds, nil
+}
+
+// authenticate checks the handshake token and returns the access level of the
+// peer.
+func authenticate(hs *protocol.HandshakeData) (string, error) {
+	if len(authCredentials) == 0 {
+		if hs.Role == "monitor" {
+			return accessAdmin, nil
+		}
+		return "", nil
+	}
+	if hs.Token == "" {
+		return "", fmt.Errorf("missing token")
+	}
+
+	access, found := matchCredential(hs.Role, hs.Token, func(id string) bool {
+		return id == "" || id == hs.ClientID
+	})
+	if !found {
+		return "", fmt.Errorf("invalid credentials for %s %q", hs.Role, hs.ClientID)
+	}
+	return access, nil
+}
+
+// authenticateToken checks a bearer token presented to the HTTP API. Requests
+// carry no identity, so any monitor token is accepted, whatever its id.
+func authenticateToken(token string) (string, error) {
+	if len(authCredentials) == 0 {
+		return accessAdmin, nil
+	}
+	if token == "" {
+		return "", fmt.Errorf("missing token")
+	}
+
+	access, found := matchCredential("monitor", token, func(string) bool { return true })
+	if !found {
+		return "", fmt.Errorf("invalid token")
+	}
+	return access, nil
+}
+
+// matchCredential looks for a credential of the role with the given token
+// whose id is accepted by idOK. Every credential is compared in constant time
+// so the response time does not reveal which tokens exist.
+func matchCredential(role, token string, idOK func(id string) bool) (string, bool) {
+	var (
+		access string
+		found  bool
+	)
+	for _, cred := range authCredentials {
+		match := subtle.ConstantTimeCompare([]byte(cred.Token), []byte(token)) == 1
+		if match && !found && cred.Role == role && idOK(cred.ID) {
+			access, found = cred.Access, true
+		}
+	}
+	return access, found
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bufio"
+	"libs/protocol"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useCredentials loads the example credentials file for the test's duration.
+func useCredentials(t *testing.T) {
+	t.Helper()
+	creds, err := loadCredentials("auth.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := authCredentials
+	authCredentials = creds
+	t.Cleanup(func() { authCredentials = saved })
+}
+
+func TestLoadCredentials(t *testing.T) {
+	creds, err := loadCredentials("auth.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []credential{
+		{Token: "change-me-agents", Role: "client"},
+		{ID: "db-01", Token: "change-me-db-01", Role: "client"},
+		{ID: "dashboard", Token: "change-me-readonly", Role: "monitor", Access: accessRead},
+		{Token: "change-me-admin", Role: "monitor", Access: accessAdmin},
+	}
+	if len(creds) != len(want) {
+		t.Fatalf("loaded %d credentials, want %d", len(creds), len(want))
+	}
+	for i := range want {
+		if creds[i] != want[i] {
+			t.Fatalf("credential #%d = %+v, want %+v", i+1, creds[i], want[i])
+		}
+	}
+
+	invalid := map[string]string{
+		"missing token":  `[{"role": "client"}]`,
+		"unknown role":   `[{"token": "x", "role": "admin"}]`,
+		"unknown access": `[{"token": "x", "role": "monitor", "access": "write"}]`,
+		"not an array":   `{"token": "x"}`,
+	}
+	for name, content := range invalid {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "auth.json")
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := loadCredentials(path); err == nil {
+				t.Fatalf("loadCredentials accepted %s", content)
+			}
+		})
+	}
+
+	// Monitors default to read access and clients never get one.
+	path := filepath.Join(t.TempDir(), "auth.json")
+	os.WriteFile(path, []byte(`[{"token": "m", "role": "monitor"}, {"token": "c", "role": "client", "access": "admin"}]`), 0o600)
+	creds, err = loadCredentials(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds[0].Access != accessRead || creds[1].Access != "" {
+		t.Fatalf("default access = %q and %q, want read and none", creds[0].Access, creds[1].Access)
+	}
+}
+
+func TestAuthenticateHandshake(t *testing.T) {
+	useCredentials(t)
+
+	tests := []struct {
+		name       string
+		hs         protocol.HandshakeData
+		wantAccess string
+		wantErr    string
+	}{
+		{"missing token", protocol.HandshakeData{Role: "client", ClientID: "web-01"}, "", "missing token"},
+		{"wrong token", protocol.HandshakeData{Role: "client", ClientID: "web-01", Token: "guess"}, "", "invalid credentials"},
+		{"shared client token", protocol.HandshakeData{Role: "client", ClientID: "web-01", Token: "change-me-agents"}, "", ""},
+		{"per-client token", protocol.HandshakeData{Role: "client", ClientID: "db-01", Token: "change-me-db-01"}, "", ""},
+		{"per-client token for another id", protocol.HandshakeData{Role: "client", ClientID: "web-01", Token: "change-me-db-01"}, "", "invalid credentials"},
+		{"client token as monitor", protocol.HandshakeData{Role: "monitor", ClientID: "ops", Token: "change-me-agents"}, "", "invalid credentials"},
+		{"read monitor", protocol.HandshakeData{Role: "monitor", ClientID: "dashboard", Token: "change-me-readonly"}, accessRead, ""},
+		{"read token under another name", protocol.HandshakeData{Role: "monitor", ClientID: "ops", Token: "change-me-readonly"}, "", "invalid credentials"},
+		{"admin monitor", protocol.HandshakeData{Role: "monitor", ClientID: "ops", Token: "change-me-admin"}, accessAdmin, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			access, err := authenticate(&tt.hs)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one mentioning %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || access != tt.wantAccess {
+				t.Fatalf("authenticate = %q, %v; want %q", access, err, tt.wantAccess)
+			}
+		})
+	}
+}
+
+func TestAuthenticateDisabled(t *testing.T) {
+	saved := authCredentials
+	authCredentials = nil
+	defer func() { authCredentials = saved }()
+
+	if access, err := authenticate(&protocol.HandshakeData{Role: "monitor"}); err != nil || access != accessAdmin {
+		t.Fatalf("monitor without auth = %q, %v; want admin", access, err)
+	}
+	if access, err := authenticateToken(""); err != nil || access != accessAdmin {
+		t.Fatalf("HTTP without auth = %q, %v; want admin", access, err)
+	}
+}
+
+func TestHTTPIntervalRequiresAdmin(t *testing.T) {
+	useCredentials(t)
+	handler := newHTTPHandler()
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"missing token", "", http.StatusUnauthorized},
+		{"wrong token", "guess", http.StatusUnauthorized},
+		{"client token", "change-me-agents", http.StatusUnauthorized},
+		{"read token", "change-me-readonly", http.StatusForbidden},
+		// Authorized: the request gets as far as looking up the client.
+		{"admin token", "change-me-admin", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/clients/nobody/interval", strings.NewReader(`{"interval_ms": 1000}`))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestIntervalSetRequestRequiresAdmin(t *testing.T) {
+	for _, tt := range []struct {
+		access string
+		want   string
+	}{
+		{accessRead, protocol.ErrorForbidden},
+		{accessAdmin, protocol.ErrorNotFound},
+	} {
+		t.Run(tt.access, func(t *testing.T) {
+			server, peer := net.Pipe()
+			defer server.Close()
+			defer peer.Close()
+
+			ctx := &messageContext{
+				connSession: &connSession{remote: "monitor-" + tt.access, conn: server, role: "monitor", access: tt.access, done: make(chan struct{})},
+				msg:         protocol.Message{Type: "interval_set_request", Data: &protocol.IntervalUpdateData{ClientID: "nobody", IntervalMs: 1000}},
+				at:          time.Now(),
+			}
+			go dispatchMessage(ctx)
+
+			peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+			line, err := bufio.NewReader(peer).ReadBytes('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			reply, err := protocol.Decode(line)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, ok := reply.Data.(*protocol.ErrorData)
+			if reply.Type != "error" || !ok || data.Code != tt.want {
+				t.Fatalf("reply = %s %+v, want error %s", reply.Type, reply.Data, tt.want)
+			}
+		})
+	}
+}
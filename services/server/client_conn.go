@@ -1,20 +1,31 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
 	"libs/protocol"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// clientWriteTimeout bounds every write to an agent, so one that stopped
+// reading cannot block whoever is sending to it (shutdown notices, kicks,
+// interval changes) once its socket buffer is full.
+const clientWriteTimeout = 10 * time.Second
+
 // ClientConn wraps a raw TCP connection to a monitored client allowing
 // concurrent writes through an internal mutex.
 type ClientConn struct {
 	remote   string
 	conn     net.Conn
-	enc      *json.Encoder
 	mu       sync.Mutex
 	clientID string
+	seq      uint64
+	// replaced is set when a newer connection took over the client ID
+	// (--duplicate-id=kick); its metrics are ignored from then on.
+	replaced atomic.Bool
 }
 
 var (
@@ -23,53 +34,81 @@ var (
 	clientConnByID = make(map[string]*ClientConn)
 )
 
-// send serializes and forwards a protocol message to the connected client.
+// send stamps, serializes and forwards a protocol message to the connected
+// client, giving up after clientWriteTimeout.
 func (c *ClientConn) send(msg protocol.Message) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	return c.enc.Encode(msg)
+	c.seq++
+	msg.Seq = c.seq
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+	payload, err := protocol.Encode(msg)
+	if err != nil {
+		return err
+	}
+	if err := c.conn.SetWriteDeadline(time.Now().Add(clientWriteTimeout)); err != nil {
+		return err
+	}
+	_, err = c.conn.Write(payload)
+	return err
 }
 
-// registerClientConn stores a new client connection keyed by remote address and
-// initial client ID, creating the encoder on top of the provided TCP socket.
-func registerClientConn(remote string, conn net.Conn, clientID string) *ClientConn {
-	clientConnMu.Lock()
-	defer clientConnMu.Unlock()
-
-	cc := &ClientConn{
-		remote:   remote,
-		conn:     conn,
-		enc:      json.NewEncoder(conn),
-		clientID: clientID,
-	}
+// Policies applied when a handshake announces a client_id that another live
+// connection already uses (--duplicate-id).
+const (
+	duplicateReject = "reject"
+	duplicateKick   = "kick"
+	duplicateSuffix = "suffix"
+)
 
-	clientConns[remote] = cc
-	if clientID != "" {
-		clientConnByID[clientID] = cc
-	}
+var duplicateIDPolicy = duplicateReject
 
-	return cc
-}
+var errDuplicateClientID = errors.New("client_id already in use")
 
-// updateClientConnID keeps the cross references in sync when a client sends a
-// handshake with a different identifier.
-func updateClientConnID(remote, clientID string) {
+// registerClientConn stores a client connection keyed by remote address and
+// claims its client ID. When the ID belongs to another connection the
+// duplicate policy decides: reject the newcomer, displace the old connection
+// (returned so the caller can notify and close it) or assign the first free
+// "<id>-N". The ID actually assigned is cc.clientID.
+func registerClientConn(remote string, conn net.Conn, clientID string) (cc *ClientConn, displaced *ClientConn, err error) {
 	clientConnMu.Lock()
 	defer clientConnMu.Unlock()
 
+	if owner, taken := clientConnByID[clientID]; taken && owner.remote != remote {
+		switch duplicateIDPolicy {
+		case duplicateKick:
+			displaced = owner
+			displaced.replaced.Store(true)
+			delete(clientConnByID, clientID)
+		case duplicateSuffix:
+			base := clientID
+			for n := 2; taken; n++ {
+				clientID = fmt.Sprintf("%s-%d", base, n)
+				_, taken = clientConnByID[clientID]
+			}
+		default:
+			return nil, nil, fmt.Errorf("%w: %s", errDuplicateClientID, clientID)
+		}
+	}
+
 	cc, ok := clientConns[remote]
 	if !ok {
-		return
+		cc = &ClientConn{
+			remote: remote,
+			conn:   conn,
+		}
+		clientConns[remote] = cc
 	}
-
-	if cc.clientID != "" {
+	if cc.clientID != "" && clientConnByID[cc.clientID] == cc {
 		delete(clientConnByID, cc.clientID)
 	}
 
 	cc.clientID = clientID
-	if clientID != "" {
-		clientConnByID[clientID] = cc
-	}
+	clientConnByID[clientID] = cc
+
+	return cc, displaced, nil
 }
 
 // unregisterClientConn drops the references to a client after the connection
@@ -83,7 +122,8 @@ func unregisterClientConn(remote string) {
 		return
 	}
 
-	if cc.clientID != "" {
+	// Under the kick policy the ID may already belong to a newer connection.
+	if cc.clientID != "" && clientConnByID[cc.clientID] == cc {
 		delete(clientConnByID, cc.clientID)
 	}
 
@@ -98,3 +138,16 @@ func getClientConnByID(clientID string) (*ClientConn, bool) {
 	cc, ok := clientConnByID[clientID]
 	return cc, ok
 }
+
+// snapshotClientConns returns a copy of the registered client connections so
+// they can be messaged without holding the registry mutex.
+func snapshotClientConns() []*ClientConn {
+	clientConnMu.Lock()
+	defer clientConnMu.Unlock()
+
+	list := make([]*ClientConn, 0, len(clientConns))
+	for _, cc := range clientConns {
+		list = append(list, cc)
+	}
+	return list
+}
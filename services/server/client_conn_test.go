@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"libs/protocol"
+	"net"
+	"testing"
+	"time"
+)
+
+// useDuplicatePolicy sets --duplicate-id for the test and registers a first
+// connection owning client ID "agent".
+func useDuplicatePolicy(t *testing.T, policy string) *ClientConn {
+	t.Helper()
+	saved := duplicateIDPolicy
+	duplicateIDPolicy = policy
+	t.Cleanup(func() { duplicateIDPolicy = saved })
+
+	return registerTestClientConn(t, "10.0.0.1:1000", "agent")
+}
+
+func registerTestClientConn(t *testing.T, remote, clientID string) *ClientConn {
+	t.Helper()
+	server, peer := net.Pipe()
+	t.Cleanup(func() {
+		unregisterClientConn(remote)
+		server.Close()
+		peer.Close()
+	})
+
+	cc, displaced, err := registerClientConn(remote, server, clientID)
+	if err != nil {
+		t.Fatalf("register %s as %s: %v", remote, clientID, err)
+	}
+	if displaced != nil {
+		t.Fatalf("register %s displaced %s", remote, displaced.remote)
+	}
+	return cc
+}
+
+func TestDuplicateIDReject(t *testing.T) {
+	first := useDuplicatePolicy(t, duplicateReject)
+
+	server, peer := net.Pipe()
+	defer server.Close()
+	defer peer.Close()
+	defer unregisterClientConn("10.0.0.2:2000")
+
+	if _, _, err := registerClientConn("10.0.0.2:2000", server, "agent"); !errors.Is(err, errDuplicateClientID) {
+		t.Fatalf("duplicate handshake error = %v, want errDuplicateClientID", err)
+	}
+	if cc, ok := getClientConnByID("agent"); !ok || cc != first {
+		t.Fatal("rejected handshake took over the ID")
+	}
+}
+
+func TestDuplicateIDSuffix(t *testing.T) {
+	useDuplicatePolicy(t, duplicateSuffix)
+
+	second := registerTestClientConn(t, "10.0.0.2:2000", "agent")
+	third := registerTestClientConn(t, "10.0.0.3:3000", "agent")
+	if second.clientID != "agent-2" || third.clientID != "agent-3" {
+		t.Fatalf("assigned %s and %s, want agent-2 and agent-3", second.clientID, third.clientID)
+	}
+	if cc, ok := getClientConnByID("agent"); !ok || cc.remote != "10.0.0.1:1000" {
+		t.Fatal("the original connection lost its ID")
+	}
+}
+
+func TestDuplicateIDKick(t *testing.T) {
+	first := useDuplicatePolicy(t, duplicateKick)
+
+	server, peer := net.Pipe()
+	defer server.Close()
+	defer peer.Close()
+	defer unregisterClientConn("10.0.0.2:2000")
+
+	second, displaced, err := registerClientConn("10.0.0.2:2000", server, "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if displaced != first || !first.replaced.Load() || second.replaced.Load() {
+		t.Fatalf("displaced %v (replaced %t), want the first connection marked replaced", displaced, first.replaced.Load())
+	}
+	if cc, ok := getClientConnByID("agent"); !ok || cc != second {
+		t.Fatal("the new connection does not own the ID")
+	}
+
+	// The old connection closes in the background; metrics it still sends
+	// must not reach the state, history or alerts of the ID.
+	defer removeClientState(first.remote)
+	updateClientState(first.remote, time.Now(), func(state *ClientState) {
+		state.Handshake = &protocol.HandshakeData{Role: "client", ClientID: "agent"}
+	})
+	ctx := &messageContext{
+		connSession: &connSession{remote: first.remote, conn: first.conn, role: "client", peer: first, done: make(chan struct{})},
+		msg:         protocol.Message{Type: "cpu_usage", Data: &protocol.CpuUsageData{Usage: 50}},
+		at:          time.Now(),
+	}
+	if !dispatchMessage(ctx) {
+		t.Fatal("dispatch closed the replaced connection before the kick notice")
+	}
+	if state, _ := getClientState(first.remote); state.CPU != nil {
+		t.Fatalf("replaced connection updated the state: %+v", state.CPU)
+	}
+
+	// Its cleanup leaves the ID with the new connection.
+	unregisterClientConn(first.remote)
+	if cc, ok := getClientConnByID("agent"); !ok || cc != second {
+		t.Fatal("unregistering the replaced connection released the new one's ID")
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"libs/protocol"
+	"net/http"
+)
+
+// webFiles holds the browser dashboard. It is a monitor like the TUI: it
+// talks to /ws and authenticates in the handshake, so the static files
+// themselves are public.
+//
+//go:embed web
+var webFiles embed.FS
+
+// dashboardHandler serves the embedded dashboard at the root of the HTTP API,
+// plus version.js, which hands the dashboard the protocol version of this
+// build so it never needs to be copied into the static files.
+func dashboardHandler() http.Handler {
+	root, err := fs.Sub(webFiles, "web")
+	if err != nil {
+		panic(err)
+	}
+
+	version, _ := json.Marshal(protocol.ProtocolVersion)
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServerFS(root))
+	mux.HandleFunc("/version.js", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		fmt.Fprintf(w, "const PROTOCOL_VERSION = %s;\n", version)
+	})
+	return mux
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"libs/protocol"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// eventLogSize is how many recent events are kept for Last-Event-ID resume.
+	eventLogSize = 1000
+	// eventBuffer bounds the events waiting for one SSE subscriber; a
+	// subscriber that falls further behind is dropped and must resume.
+	eventBuffer = 256
+	// eventKeepAlive is how often an idle stream gets a comment line, so
+	// proxies keep it open and dead subscribers are noticed.
+	eventKeepAlive = 15 * time.Second
+)
+
+// streamEvent is one entry of the event log, serialized once for every
+// subscriber.
+type streamEvent struct {
+	id       uint64
+	kind     string
+	clientID string
+	data     []byte
+}
+
+var (
+	eventsMu     sync.Mutex
+	eventLog     []streamEvent
+	lastEventID  uint64
+	eventSubs    = make(map[chan streamEvent]struct{})
+	eventsClosed = make(chan struct{})
+)
+
+// publishEvent records client_update, client_removed and alert messages in the
+// event log and hands them to the SSE subscribers. Other types, and everything
+// when the HTTP API is off, are ignored.
+func publishEvent(msg protocol.Message) {
+	if httpServer == nil {
+		return
+	}
+
+	var clientID string
+	switch data := msg.Data.(type) {
+	case protocol.ClientUpdateData:
+		clientID = summaryClientID(data.Client)
+	case protocol.ClientRemovedData:
+		clientID = data.ClientID
+	case protocol.AlertData:
+		clientID = data.ClientID
+	default:
+		return
+	}
+
+	payload, err := json.Marshal(msg.Data)
+	if err != nil {
+		fmt.Println("❌ Error encoding event:", err)
+		return
+	}
+
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+
+	lastEventID++
+	ev := streamEvent{id: lastEventID, kind: msg.Type, clientID: clientID, data: payload}
+	eventLog = append(eventLog, ev)
+	if len(eventLog) > eventLogSize {
+		eventLog = eventLog[len(eventLog)-eventLogSize:]
+	}
+
+	for sub := range eventSubs {
+		select {
+		case sub <- ev:
+		default:
+			delete(eventSubs, sub)
+			close(sub)
+		}
+	}
+}
+
+// subscribeEvents registers a subscriber and returns, atomically with the
+// registration, the logged events newer than after.
+func subscribeEvents(after uint64) ([]streamEvent, chan streamEvent) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+
+	var backlog []streamEvent
+	for _, ev := range eventLog {
+		if ev.id > after {
+			backlog = append(backlog, ev)
+		}
+	}
+
+	sub := make(chan streamEvent, eventBuffer)
+	eventSubs[sub] = struct{}{}
+	return backlog, sub
+}
+
+// unsubscribeEvents removes a subscriber unless it was already dropped.
+func unsubscribeEvents(sub chan streamEvent) {
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+
+	if _, ok := eventSubs[sub]; ok {
+		delete(eventSubs, sub)
+		close(sub)
+	}
+}
+
+// closeEventStreams ends every SSE response; http.Server.Shutdown would
+// otherwise wait for them until its timeout.
+func closeEventStreams() {
+	close(eventsClosed)
+}
+
+// handleHTTPEvents streams the events as Server-Sent Events. ?client_id=
+// restricts the stream to one client, and a Last-Event-ID header (or
+// ?last_event_id=) replays the logged events missed since that ID.
+func handleHTTPEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeHTTPError(w, http.StatusInternalServerError, protocol.ErrorInternal, "streaming not supported")
+		return
+	}
+
+	clientID := r.URL.Query().Get("client_id")
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var after uint64
+	if lastID != "" {
+		n, err := strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			writeHTTPError(w, http.StatusBadRequest, protocol.ErrorInvalidRequest, fmt.Sprintf("invalid Last-Event-ID %q", lastID))
+			return
+		}
+		after = n
+	}
+
+	backlog, sub := subscribeEvents(after)
+	defer unsubscribeEvents(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+
+	write := func(ev streamEvent) error {
+		if clientID != "" && ev.clientID != clientID {
+			return nil
+		}
+		_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.id, ev.kind, ev.data)
+		return err
+	}
+
+	for _, ev := range backlog {
+		if err := write(ev); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case ev, ok := <-sub:
+			if !ok {
+				// Dropped for falling behind: the client resumes from its last ID.
+				return
+			}
+			if err := write(ev); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-eventsClosed:
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"libs/protocol"
+	"time"
+)
+
+func init() {
+	registerHandler(messageHandler{
+		Type:       "handshake",
+		NewPayload: func() interface{} { return &protocol.HandshakeData{} },
+		Handle:     handleHandshake,
+	})
+	registerHandler(messageHandler{
+		Type:       "ping",
+		NewPayload: func() interface{} { return &protocol.HeartbeatData{} },
+		Roles:      []string{"client", "monitor"},
+		Handle:     handlePing,
+	})
+	registerHandler(messageHandler{
+		Type:       "pong",
+		NewPayload: func() interface{} { return &protocol.HeartbeatData{} },
+		Roles:      []string{"client", "monitor"},
+		Handle:     handlePong,
+	})
+	registerHandler(messageHandler{
+		Type:       "general_data",
+		NewPayload: func() interface{} { return &protocol.GeneralData{} },
+		Roles:      []string{"client"},
+		Handle:     handleGeneralData,
+	})
+	registerHandler(messageHandler{
+		Type:       "samples_replay",
+		NewPayload: func() interface{} { return &protocol.SamplesReplayData{} },
+		Roles:      []string{"client"},
+		Handle:     handleSamplesReplay,
+	})
+	registerHandler(messageHandler{
+		Type:       "interval_update",
+		NewPayload: func() interface{} { return &protocol.IntervalUpdateData{} },
+		Roles:      []string{"client"},
+		Handle:     handleIntervalUpdate,
+	})
+	registerHandler(messageHandler{
+		Type:       "clients_request",
+		NewPayload: func() interface{} { return &protocol.ClientsRequestData{} },
+		Roles:      []string{"monitor"},
+		Handle:     handleClientsRequest,
+	})
+	registerHandler(messageHandler{
+		Type:       "interval_set_request",
+		NewPayload: func() interface{} { return &protocol.IntervalUpdateData{} },
+		Roles:      []string{"monitor"},
+		Access:     accessAdmin,
+		Handle:     handleIntervalSetRequest,
+	})
+	registerHandler(messageHandler{
+		Type:       "history_request",
+		NewPayload: func() interface{} { return &protocol.HistoryRequestData{} },
+		Roles:      []string{"monitor"},
+		Handle:     handleHistoryRequest,
+	})
+	registerHandler(messageHandler{
+		Type:       "alert_ack",
+		NewPayload: func() interface{} { return &protocol.AlertAckData{} },
+		Roles:      []string{"monitor"},
+		Handle:     handleAlertAck,
+	})
+}
+
+// handleGeneralData stores the static hardware description of a client.
+func handleGeneralData(ctx *messageContext) error {
+	general := ctx.msg.Data.(*protocol.GeneralData)
+	state := updateClientState(ctx.remote, ctx.at, func(state *ClientState) {
+		state.General = general
+	})
+	fmt.Printf("🖥️ General data from %s: %s (%d cores @ %.2f MHz)\n", ctx.remote, general.ModelName, general.Cores, general.Mhz)
+	if general.Hostname != "" {
+		fmt.Printf("🏷️ Host %s: %s %s %s, kernel %s (%s), booted %s\n", ctx.remote, general.Hostname, general.Platform,
+			general.PlatformVersion, general.KernelVersion, general.KernelArch, general.BootTime.Format(time.RFC3339))
+	}
+	broadcastClientUpdate(state)
+	debugState(ctx.remote, state)
+	return nil
+}
+
+// handleSamplesReplay stores the samples a client buffered while offline.
+func handleSamplesReplay(ctx *messageContext) error {
+	replay := ctx.msg.Data.(*protocol.SamplesReplayData)
+	state, _ := getClientState(ctx.remote)
+	stored, err := recordReplayedSamples(state, replay.Samples)
+	fmt.Printf("📥 Replay from %s: stored %d/%d buffered samples\n", ctx.remote, stored, len(replay.Samples))
+	if err != nil {
+		return fmt.Errorf("storing replayed samples: %w", err)
+	}
+	return nil
+}
+
+// handleIntervalUpdate records the collection interval reported by a client.
+func handleIntervalUpdate(ctx *messageContext) error {
+	upd := ctx.msg.Data.(*protocol.IntervalUpdateData)
+	state := updateClientState(ctx.remote, ctx.at, func(state *ClientState) {
+		state.Interval = time.Duration(upd.IntervalMs) * time.Millisecond
+	})
+	fmt.Printf("⏱️ Interval update from %s: %dms\n", ctx.remote, upd.IntervalMs)
+	broadcastClientUpdate(state)
+	return nil
+}
+
+// handleClientsRequest sends the current clients and alerts to a monitor.
+func handleClientsRequest(ctx *messageContext) error {
+	if err := sendClientsState(ctx.monitor); err != nil {
+		return fmt.Errorf("sending clients state: %w", err)
+	}
+	if err := sendAlertsState(ctx.monitor); err != nil {
+		return fmt.Errorf("sending alerts state: %w", err)
+	}
+	return nil
+}
+
+// handleIntervalSetRequest forwards a monitor's interval change to the client.
+func handleIntervalSetRequest(ctx *messageContext) error {
+	req := ctx.msg.Data.(*protocol.IntervalUpdateData)
+	if req.ClientID == "" || req.IntervalMs <= 0 {
+		return newRequestError(protocol.ErrorInvalidRequest, "invalid interval request: client_id and a positive interval_ms are required")
+	}
+	if err := sendIntervalSet(req.ClientID, req.IntervalMs); err != nil {
+		if errors.Is(err, errClientNotConnected) {
+			return newRequestError(protocol.ErrorNotFound, "client %s not connected", req.ClientID)
+		}
+		return fmt.Errorf("sending interval to client: %w", err)
+	}
+	return nil
+}
+
+// handleHistoryRequest answers a monitor's history query.
+func handleHistoryRequest(ctx *messageContext) error {
+	req := ctx.msg.Data.(*protocol.HistoryRequestData)
+	if err := sendHistoryResponse(ctx.monitor, *req); err != nil {
+		return fmt.Errorf("sending history response: %w", err)
+	}
+	return nil
+}
+
+// handleAlertAck marks an alert as acknowledged by the monitor and tells the others.
+func handleAlertAck(ctx *messageContext) error {
+	ack := ctx.msg.Data.(*protocol.AlertAckData)
+	alert, err := acknowledgeAlert(ack.AlertID, ctx.monitor.id)
+	if err != nil {
+		return newRequestError(protocol.ErrorNotFound, "invalid alert ack: %v", err)
+	}
+	logAlert(alert)
+	broadcastAlert(alert)
+	return nil
+}
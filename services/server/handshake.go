@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"libs/protocol"
+	"slices"
+)
+
+// handleHandshake authenticates the peer, negotiates the protocol version and
+// registers the connection as a client or monitor. A connection handshakes
+// once: registering it again would leave the first registration behind.
+func handleHandshake(ctx *messageContext) error {
+	if ctx.role != "" {
+		return newRequestError(protocol.ErrorInvalidRequest, "handshake already completed as %s", ctx.role)
+	}
+
+	hs := ctx.msg.Data.(*protocol.HandshakeData)
+	if hs.Role == "client" {
+		if err := verifyAgentCertificate(ctx.conn, hs.ClientID); err != nil {
+			return rejectHandshake(ctx, fmt.Sprintf("client %s rejected: %v", hs.ClientID, err))
+		}
+	}
+
+	access, err := authenticate(hs)
+	if err != nil {
+		return rejectHandshake(ctx, fmt.Sprintf("authentication failed: %v", err))
+	}
+	// The handshake is kept in the client state and shared with monitors.
+	hs.Token = ""
+
+	if hs.Role != "client" && hs.Role != "monitor" {
+		return rejectHandshake(ctx, fmt.Sprintf("unknown role %q", hs.Role))
+	}
+	if _, ok := ctx.conn.(*wsConn); ok && hs.Role != "monitor" {
+		return rejectHandshake(ctx, "only monitors may connect over WebSocket")
+	}
+	if hs.Role == "client" && hs.ClientID == "" {
+		return rejectHandshake(ctx, "client_id is required")
+	}
+	version, err := protocol.NegotiateVersion(hs.Version)
+	if err != nil {
+		return rejectHandshake(ctx, err.Error())
+	}
+	ack := protocol.HandshakeAckData{
+		Version:  version,
+		Features: serverFeatures(),
+	}
+	heartbeat := heartbeatInterval > 0 && slices.Contains(hs.Features, protocol.FeatureHeartbeat)
+	if heartbeat {
+		ack.HeartbeatMs = heartbeatInterval.Milliseconds()
+	}
+
+	switch hs.Role {
+	case "client":
+		requested := hs.ClientID
+		cc, displaced, err := registerClientConn(ctx.remote, ctx.conn, requested)
+		if err != nil {
+			return rejectHandshake(ctx, err.Error())
+		}
+		if displaced != nil {
+			kickClientConn(displaced, ctx.remote)
+		}
+		hs.ClientID = cc.clientID
+		ack.ClientID = cc.clientID
+
+		ctx.role = hs.Role
+		ctx.access = access
+		ctx.peer = cc
+		state := updateClientState(ctx.remote, ctx.at, func(state *ClientState) {
+			state.Handshake = hs
+			state.Interval = defaultStatsInterval
+		})
+		setClientIDForRemote(ctx.remote, hs.ClientID)
+		if err := ctx.send(protocol.Message{Type: "handshake_ack", Data: ack}); err != nil {
+			return fmt.Errorf("sending handshake ack: %w", err)
+		}
+		if hs.ClientID != requested {
+			fmt.Printf("🪪 Client ID %s from %s already in use; assigned %s\n", requested, ctx.remote, hs.ClientID)
+		}
+		if heartbeat {
+			ctx.startHeartbeat()
+		}
+		fmt.Printf("🤝 Client handshake from %s: ClientID=%s, Version=%s (negotiated %s)\n", ctx.remote, hs.ClientID, hs.Version, version)
+		broadcastClientUpdate(state)
+		debugState(ctx.remote, state)
+	case "monitor":
+		ctx.role = hs.Role
+		ctx.access = access
+		ctx.monitor = registerMonitor(ctx.remote, hs.ClientID, ctx.conn)
+		ctx.peer = ctx.monitor
+		if err := ctx.send(protocol.Message{Type: "handshake_ack", Data: ack}); err != nil {
+			return fmt.Errorf("sending handshake ack: %w", err)
+		}
+		if heartbeat {
+			ctx.startHeartbeat()
+		}
+		fmt.Printf("🛰️  Monitor handshake from %s: ID=%s, Version=%s (negotiated %s), Access=%s\n", ctx.remote, hs.ClientID, hs.Version, version, access)
+	}
+	return nil
+}
+
+// kickClientConn tells a client that a newer connection took over its
+// client_id (--duplicate-id=kick) and closes it. Its connection handler then
+// cleans up without announcing the ID as removed, since it is still in use.
+// The notice is written in the background, bounded by clientWriteTimeout, so
+// an old connection that stopped reading does not stall the new handshake.
+func kickClientConn(cc *ClientConn, replacedBy string) {
+	clientID := cc.clientID
+	fmt.Printf("🥾 Disconnecting %s: client_id %s taken over by %s\n", cc.remote, clientID, replacedBy)
+	go func() {
+		err := cc.send(protocol.Message{
+			Type: "error",
+			Data: protocol.ErrorData{
+				Code:    protocol.ErrorConflict,
+				Message: fmt.Sprintf("client_id %s taken over by a new connection", clientID),
+			},
+		})
+		if err != nil {
+			fmt.Printf("❌ Error notifying %s: %v\n", cc.remote, err)
+		}
+		cc.conn.Close()
+	}()
+}
+
+// serverFeatures lists the optional features this server can serve. History
+// and offline replay depend on the on-disk store being enabled.
+func serverFeatures() []string {
+	features := []string{protocol.FeatureAlerts}
+	if heartbeatInterval > 0 {
+		features = append(features, protocol.FeatureHeartbeat)
+	}
+	if historyDB != nil {
+		features = append(features, protocol.FeatureHistory, protocol.FeatureSamplesReplay)
+	}
+	return features
+}
+
+// rejectHandshake tells the peer why it cannot be served and ends the
+// connection.
+func rejectHandshake(ctx *messageContext, reason string) error {
+	err := ctx.send(protocol.Message{
+		Type: "handshake_error",
+		Data: protocol.HandshakeErrorData{
+			Reason:  reason,
+			Version: protocol.ProtocolVersion,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %s (could not notify peer: %v)", errDisconnect, reason, err)
+	}
+	return fmt.Errorf("%w: %s", errDisconnect, reason)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"libs/protocol"
+	"time"
+)
+
+// A client is late once its last update is older than healthLateAfter
+// intervals, and stale after healthStaleAfter intervals. A stale agent may
+// still answer pings (its connection is alive) while its collectors hang.
+const (
+	healthLateAfter  = 2
+	healthStaleAfter = 4
+)
+
+// healthCheckPeriod is how often the health of the clients is re-evaluated.
+const healthCheckPeriod = time.Second
+
+// clientHealth classifies a client by how long ago the server received its
+// last update, relative to its stats interval. The receive time is used
+// instead of LastUpdate, the producer timestamp, so an agent whose clock lags
+// behind is not reported stale while it reports on time.
+func clientHealth(state *ClientState, now time.Time) string {
+	interval := state.Interval
+	if interval <= 0 {
+		interval = defaultStatsInterval
+	}
+
+	age := now.Sub(state.ReceivedAt)
+	switch {
+	case age > healthStaleAfter*interval:
+		return protocol.HealthStale
+	case age > healthLateAfter*interval:
+		return protocol.HealthLate
+	default:
+		return protocol.HealthHealthy
+	}
+}
+
+// watchClientHealth re-evaluates every client periodically and broadcasts an
+// update to the monitors whenever one changes health, since no metric arrives
+// to trigger it when an agent goes quiet. It never returns.
+func watchClientHealth() {
+	last := make(map[string]string)
+	ticker := time.NewTicker(healthCheckPeriod)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		seen := make(map[string]bool)
+		for _, summary := range collectClientSummaries() {
+			seen[summary.RemoteAddr] = true
+			previous, known := last[summary.RemoteAddr]
+			last[summary.RemoteAddr] = summary.Health
+			// New clients were just announced by their handshake.
+			if !known || previous == summary.Health {
+				continue
+			}
+
+			fmt.Printf("🩺 Client %s (%s) is now %s\n", summary.Handshake.ClientID, summary.RemoteAddr, summary.Health)
+			broadcastToMonitors(protocol.Message{
+				Type: "client_update",
+				Data: protocol.ClientUpdateData{Client: summary},
+			})
+		}
+
+		for remote := range last {
+			if !seen[remote] {
+				delete(last, remote)
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"libs/protocol"
+	"time"
+)
+
+// heartbeatMisses is how many heartbeat intervals a peer may stay silent
+// before its connection is considered dead and closed.
+const heartbeatMisses = 3
+
+// heartbeatInterval is how often peers that announced protocol.FeatureHeartbeat
+// are pinged. Zero disables heartbeats and read deadlines altogether.
+var heartbeatInterval = 10 * time.Second
+
+// readTimeout returns how long the next read on the connection may block.
+// Peers must handshake within the idle timeout, and afterwards only those
+// answering pings are held to it: legacy peers may legitimately stay quiet.
+func (s *connSession) readTimeout() time.Duration {
+	if heartbeatInterval <= 0 {
+		return 0
+	}
+	if s.role != "" && !s.heartbeat {
+		return 0
+	}
+	return heartbeatMisses * heartbeatInterval
+}
+
+// startHeartbeat pings the peer every heartbeatInterval until the connection
+// handler closes s.done. Any message from the peer, the pongs included, pushes
+// its read deadline forward.
+func (s *connSession) startHeartbeat() {
+	s.heartbeat = true
+	go func() {
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.done:
+				return
+			case now := <-ticker.C:
+				msg := protocol.Message{Type: "ping", Data: protocol.HeartbeatData{SentAt: now}}
+				if err := s.send(msg); err != nil {
+					fmt.Printf("❌ Error pinging %s: %v\n", s.remote, err)
+					return
+				}
+			}
+		}
+	}()
+}
+
+// handlePing answers a peer checking on the server, echoing its send time.
+func handlePing(ctx *messageContext) error {
+	data := ctx.msg.Data.(*protocol.HeartbeatData)
+	return ctx.send(protocol.Message{Type: "pong", Data: *data})
+}
+
+// handlePong accepts the answer to our pings. Receiving it already refreshed
+// the read deadline, so there is nothing else to do.
+func handlePong(ctx *messageContext) error {
+	return nil
+}
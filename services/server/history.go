@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"libs/protocol"
+	"math"
+	"time"
+)
+
+const (
+	defaultHistoryRange = time.Hour
+	minHistoryStep      = time.Second
+	maxHistoryPoints    = 5000
+)
+
+// queryHistory answers a history request from the persisted samples, grouping
+// them in buckets of StepMs aligned to the start of the requested range.
+func queryHistory(req protocol.HistoryRequestData) (protocol.HistoryResponseData, error) {
+	resp := protocol.HistoryResponseData{
+		ClientID:    req.ClientID,
+		Metric:      req.Metric,
+		Aggregation: req.Aggregation,
+		Points:      []protocol.HistoryPoint{},
+	}
+
+	if historyDB == nil {
+		return resp, fmt.Errorf("history storage is disabled")
+	}
+	if req.ClientID == "" {
+		return resp, fmt.Errorf("client_id is required")
+	}
+
+	field, err := resolveMetricField(req.Metric, req.Field)
+	if err != nil {
+		return resp, err
+	}
+	resp.Field = field
+
+	if resp.Aggregation == "" {
+		resp.Aggregation = "avg"
+	}
+	if !isValidAggregation(resp.Aggregation) {
+		return resp, fmt.Errorf("unknown aggregation %q", resp.Aggregation)
+	}
+
+	to := req.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	from := req.From
+	if from.IsZero() {
+		from = to.Add(-defaultHistoryRange)
+	}
+	if !from.Before(to) {
+		return resp, fmt.Errorf("invalid range: from must be before to")
+	}
+
+	step := time.Duration(req.StepMs) * time.Millisecond
+	if step < minHistoryStep {
+		step = minHistoryStep
+	}
+	// [from, to] spans span/step+1 buckets, the last one starting at or before
+	// to. Too many of them and the step grows to the next whole millisecond
+	// above span/maxHistoryPoints, so StepMs reports it exactly.
+	if span := to.Sub(from); span/step >= maxHistoryPoints {
+		step = (span / maxHistoryPoints).Truncate(time.Millisecond) + time.Millisecond
+	}
+	resp.From, resp.To, resp.StepMs = from, to, step.Milliseconds()
+
+	samples, err := historyDB.query(req.ClientID, req.Metric, from, to)
+	if err != nil {
+		return resp, err
+	}
+
+	var (
+		current historyBucket
+		started bool
+	)
+	for _, sample := range samples {
+		payload, err := decodeMetricPayload(req.Metric, sample.Data)
+		if err != nil {
+			continue
+		}
+		value, ok := metricValue(req.Metric, field, payload)
+		if !ok {
+			return resp, fmt.Errorf("unknown field %q for metric %s", field, req.Metric)
+		}
+
+		start := from.Add(sample.Timestamp.Sub(from) / step * step)
+		if started && !start.Equal(current.start) {
+			resp.Points = append(resp.Points, current.point(resp.Aggregation))
+			started = false
+		}
+		if !started {
+			current = historyBucket{start: start, min: math.Inf(1), max: math.Inf(-1)}
+			started = true
+		}
+		current.add(value)
+	}
+	if started {
+		resp.Points = append(resp.Points, current.point(resp.Aggregation))
+	}
+
+	return resp, nil
+}
+
+// historyBucket accumulates the samples falling into one step of a query.
+type historyBucket struct {
+	start time.Time
+	sum   float64
+	min   float64
+	max   float64
+	last  float64
+	count int
+}
+
+// add folds a sample into the bucket.
+func (b *historyBucket) add(v float64) {
+	b.sum += v
+	b.min = math.Min(b.min, v)
+	b.max = math.Max(b.max, v)
+	b.last = v
+	b.count++
+}
+
+// point reduces the bucket with the requested aggregation.
+func (b *historyBucket) point(aggregation string) protocol.HistoryPoint {
+	p := protocol.HistoryPoint{Timestamp: b.start}
+	switch aggregation {
+	case "min":
+		p.Value = b.min
+	case "max":
+		p.Value = b.max
+	case "last":
+		p.Value = b.last
+	case "count":
+		p.Value = float64(b.count)
+	default:
+		p.Value = b.sum / float64(b.count)
+	}
+	return p
+}
+
+// isValidAggregation reports whether the aggregation is supported by point.
+func isValidAggregation(aggregation string) bool {
+	switch aggregation {
+	case "avg", "min", "max", "last", "count":
+		return true
+	}
+	return false
+}
+
+// sendHistoryResponse runs a history query and replies to the monitor,
+// reporting failures inside the response so the monitor can show them.
+func sendHistoryResponse(mon *MonitorConn, req protocol.HistoryRequestData) error {
+	resp, err := queryHistory(req)
+	if err != nil {
+		resp.Error = err.Error()
+	}
+
+	return mon.send(protocol.Message{
+		Type: "history_response",
+		Data: resp,
+	})
+}
+
+// recordReplayedSamples stores samples an agent buffered while it was offline.
+// They only go to the history: the live state and alerts keep reflecting the
+// most recent data the agent reported.
+func recordReplayedSamples(state *ClientState, samples []protocol.BufferedSample) (int, error) {
+	if historyDB == nil {
+		return 0, fmt.Errorf("history storage is disabled")
+	}
+	if state == nil || state.Handshake == nil || state.Handshake.ClientID == "" {
+		return 0, fmt.Errorf("client identity unknown")
+	}
+
+	stored := 0
+	for _, sample := range samples {
+		if _, ok := lookupMetric(sample.Type); !ok {
+			continue
+		}
+		if _, err := decodeMetricPayload(sample.Type, sample.Data); err != nil {
+			continue
+		}
+		if err := historyDB.append(state.Handshake.ClientID, sample.Type, sample.Timestamp, sample.Data); err != nil {
+			return stored, err
+		}
+		stored++
+	}
+	return stored, nil
+}
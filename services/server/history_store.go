@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxSegmentBytes bounds the size of a segment file before it is sealed and
+	// a new one is started for the same series.
+	maxSegmentBytes = 4 << 20
+	segmentSuffix   = ".seg"
+	indexFileName   = "index"
+)
+
+// historySample is a single stored observation for a client metric. The
+// payload is kept as raw JSON so every metric type can share the same format.
+type historySample struct {
+	Timestamp time.Time       `json:"ts"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// segmentMeta describes a sealed segment file; one line per segment is
+// appended to the series index so queries can skip unrelated files.
+type segmentMeta struct {
+	Segment int       `json:"segment"`
+	First   time.Time `json:"first"`
+	Last    time.Time `json:"last"`
+	Count   int       `json:"count"`
+	Bytes   int64     `json:"bytes"`
+}
+
+// historySeries owns the segment files of one client/metric pair.
+type historySeries struct {
+	mu     sync.Mutex
+	dir    string
+	sealed []segmentMeta
+	active segmentMeta
+	file   *os.File
+	closed bool
+}
+
+// historyStore is an embedded append-only time-series store that keeps every
+// sample reported by the agents under dir/<client>/<metric>/.
+type historyStore struct {
+	dir    string
+	mu     sync.Mutex
+	series map[string]*historySeries
+	closed bool
+}
+
+// errHistoryClosed is returned by appends and queries after close, e.g. from
+// connections still draining when shutdown flushed the store.
+var errHistoryClosed = errors.New("history store closed")
+
+// historyDB is the process-wide store; nil means persistence is disabled.
+var historyDB *historyStore
+
+// openHistoryStore prepares the data directory used by the store.
+func openHistoryStore(dir string) (*historyStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &historyStore{
+		dir:    dir,
+		series: make(map[string]*historySeries),
+	}, nil
+}
+
+// append persists a sample for the given client and metric.
+func (s *historyStore) append(clientID, metric string, ts time.Time, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	series, err := s.open(clientID, metric, true)
+	if err != nil {
+		return err
+	}
+
+	return series.append(historySample{Timestamp: ts, Data: data})
+}
+
+// query returns the samples of a series within [from, to], ordered by time.
+// Series that were never written yield no samples; nothing is created on disk.
+func (s *historyStore) query(clientID, metric string, from, to time.Time) ([]historySample, error) {
+	series, err := s.open(clientID, metric, false)
+	if err != nil || series == nil {
+		return nil, err
+	}
+	return series.query(from, to)
+}
+
+// close releases every open segment file. The store refuses appends and
+// queries afterwards, so no segment is reopened behind its back.
+func (s *historyStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	var firstErr error
+	for _, series := range s.series {
+		if err := series.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// open returns the cached series handle, loading its index from disk the first
+// time it is used. Without create, a series missing on disk returns nil so
+// reads for unknown clients or metrics leave no directories or map entries.
+func (s *historyStore) open(clientID, metric string, create bool) (*historySeries, error) {
+	dir := filepath.Join(s.dir, escapePathPart(clientID), escapePathPart(metric))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, errHistoryClosed
+	}
+	if series, ok := s.series[dir]; ok {
+		return series, nil
+	}
+
+	if create {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	} else if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	series, err := loadHistorySeries(dir)
+	if err != nil {
+		return nil, err
+	}
+	s.series[dir] = series
+	return series, nil
+}
+
+// loadHistorySeries reads the index of sealed segments of an existing series
+// directory and recovers the metadata of the active segment by scanning it.
+func loadHistorySeries(dir string) (*historySeries, error) {
+	series := &historySeries{dir: dir}
+
+	indexed := make(map[int]bool)
+	if f, err := os.Open(filepath.Join(dir, indexFileName)); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var meta segmentMeta
+			if err := json.Unmarshal(scanner.Bytes(), &meta); err != nil {
+				continue
+			}
+			series.sealed = append(series.sealed, meta)
+			indexed[meta.Segment] = true
+		}
+		f.Close()
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	segments, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	last := 0
+	for _, seg := range segments {
+		if seg > last {
+			last = seg
+		}
+	}
+	for _, meta := range series.sealed {
+		if meta.Segment > last {
+			last = meta.Segment
+		}
+	}
+
+	if last == 0 || indexed[last] {
+		series.active = segmentMeta{Segment: last + 1}
+		return series, nil
+	}
+
+	meta, err := scanSegment(series.segmentPath(last))
+	if err != nil {
+		return nil, err
+	}
+	meta.Segment = last
+	series.active = meta
+	return series, nil
+}
+
+// listSegments returns the numeric identifiers of the segment files in dir.
+func listSegments(dir string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []int
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(name, segmentSuffix))
+		if err != nil {
+			continue
+		}
+		segments = append(segments, n)
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
+
+// scanSegment rebuilds the metadata of a segment that was not sealed yet,
+// typically the one being written when the server stopped.
+func scanSegment(path string) (segmentMeta, error) {
+	var meta segmentMeta
+
+	err := readSegment(path, func(sample historySample, size int) {
+		if meta.Count == 0 || sample.Timestamp.Before(meta.First) {
+			meta.First = sample.Timestamp
+		}
+		if sample.Timestamp.After(meta.Last) {
+			meta.Last = sample.Timestamp
+		}
+		meta.Count++
+		meta.Bytes += int64(size)
+	})
+	if os.IsNotExist(err) {
+		return meta, nil
+	}
+	return meta, err
+}
+
+// readSegment decodes every sample of a segment file, skipping lines that were
+// partially written.
+func readSegment(path string, fn func(sample historySample, size int)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			var sample historySample
+			if jsonErr := json.Unmarshal(line, &sample); jsonErr == nil {
+				fn(sample, len(line))
+			}
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+// segmentPath builds the file name of a segment inside the series directory.
+func (h *historySeries) segmentPath(segment int) string {
+	return filepath.Join(h.dir, fmt.Sprintf("%08d%s", segment, segmentSuffix))
+}
+
+// append writes a sample to the active segment, sealing it first when it grew
+// past maxSegmentBytes.
+func (h *historySeries) append(sample historySample) error {
+	line, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return errHistoryClosed
+	}
+	if h.active.Count > 0 && h.active.Bytes+int64(len(line)) > maxSegmentBytes {
+		if err := h.seal(); err != nil {
+			return err
+		}
+	}
+
+	if h.file == nil {
+		f, err := os.OpenFile(h.segmentPath(h.active.Segment), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		h.file = f
+	}
+
+	if _, err := h.file.Write(line); err != nil {
+		return err
+	}
+
+	if h.active.Count == 0 || sample.Timestamp.Before(h.active.First) {
+		h.active.First = sample.Timestamp
+	}
+	if sample.Timestamp.After(h.active.Last) {
+		h.active.Last = sample.Timestamp
+	}
+	h.active.Count++
+	h.active.Bytes += int64(len(line))
+	return nil
+}
+
+// seal closes the active segment, records it in the index and starts a new one.
+func (h *historySeries) seal() error {
+	if h.file != nil {
+		if err := h.file.Close(); err != nil {
+			return err
+		}
+		h.file = nil
+	}
+
+	entry, err := json.Marshal(h.active)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(h.dir, indexFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(entry, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	h.sealed = append(h.sealed, h.active)
+	h.active = segmentMeta{Segment: h.active.Segment + 1}
+	return nil
+}
+
+// query scans the segments overlapping [from, to] and returns the matching
+// samples ordered by timestamp. The files are read without holding h.mu, so a
+// wide query never stalls append: sealed segments no longer change, and the
+// partial line of a write in progress on the active one is skipped.
+func (h *historySeries) query(from, to time.Time) ([]historySample, error) {
+	candidates, err := h.candidates(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []historySample
+	for _, meta := range candidates {
+		err := readSegment(h.segmentPath(meta.Segment), func(sample historySample, _ int) {
+			if sample.Timestamp.Before(from) || sample.Timestamp.After(to) {
+				return
+			}
+			samples = append(samples, sample)
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Timestamp.Before(samples[j].Timestamp)
+	})
+	return samples, nil
+}
+
+// candidates returns the segments that may hold samples within [from, to].
+func (h *historySeries) candidates(from, to time.Time) ([]segmentMeta, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, errHistoryClosed
+	}
+
+	candidates := make([]segmentMeta, 0, len(h.sealed)+1)
+	for _, meta := range h.sealed {
+		if meta.Last.Before(from) || meta.First.After(to) {
+			continue
+		}
+		candidates = append(candidates, meta)
+	}
+	if h.active.Count > 0 && !h.active.Last.Before(from) && !h.active.First.After(to) {
+		candidates = append(candidates, h.active)
+	}
+	return candidates, nil
+}
+
+// close syncs and releases the active segment file handle for good.
+func (h *historySeries) close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	if h.file == nil {
+		return nil
+	}
+	err := h.file.Sync()
+	if closeErr := h.file.Close(); err == nil {
+		err = closeErr
+	}
+	h.file = nil
+	return err
+}
+
+// escapePathPart turns an arbitrary identifier into a safe directory name.
+// Letters, digits, '-', '_' and '.' are kept and every other byte becomes %XX,
+// so distinct identifiers always map to distinct directories ("a/b" is
+// "a%2Fb", "a_b" stays "a_b"). The names "", "." and ".." are escaped whole.
+func escapePathPart(name string) string {
+	if name == "" {
+		return "%"
+	}
+	escapeDots := strings.Trim(name, ".") == ""
+
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			b.WriteByte(c)
+		case c == '.' && !escapeDots:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// recordHistory stores a metric sample for the client behind the given state
+// at the time the producer created it, so delayed or out-of-order samples keep
+// their own timestamp. Failures are logged so a full disk never interrupts
+// metric ingestion.
+func recordHistory(state *ClientState, metric string, at time.Time, payload interface{}) {
+	if historyDB == nil || state == nil || state.Handshake == nil || state.Handshake.ClientID == "" {
+		return
+	}
+
+	if err := historyDB.append(state.Handshake.ClientID, metric, at, payload); err != nil {
+		fmt.Printf("❌ Error storing %s history for %s: %v\n", metric, state.Handshake.ClientID, err)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// bigPayload is large enough that a handful of samples fill a segment.
+type bigPayload struct {
+	N   int    `json:"n"`
+	Pad string `json:"pad"`
+}
+
+var historyBase = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// fillSeries appends count samples one second apart, each ~1 MiB, so the
+// series spans several sealed segments.
+func fillSeries(t *testing.T, store *historyStore, count int) {
+	t.Helper()
+	pad := strings.Repeat("x", 1<<20)
+	for i := 0; i < count; i++ {
+		if err := store.append("agent", "cpu_usage", historyBase.Add(time.Duration(i)*time.Second), bigPayload{N: i, Pad: pad}); err != nil {
+			t.Fatalf("append %d: %v", i, err)
+		}
+	}
+}
+
+func sampleNumbers(t *testing.T, samples []historySample) []int {
+	t.Helper()
+	out := make([]int, 0, len(samples))
+	for _, sample := range samples {
+		var p bigPayload
+		if err := json.Unmarshal(sample.Data, &p); err != nil {
+			t.Fatalf("decode sample: %v", err)
+		}
+		out = append(out, p.N)
+	}
+	return out
+}
+
+func rangeInts(from, to int) []int {
+	out := []int{}
+	for i := from; i <= to; i++ {
+		out = append(out, i)
+	}
+	return out
+}
+
+func TestHistoryStoreQueryRanges(t *testing.T) {
+	store, err := openHistoryStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.close()
+
+	const count = 10
+	fillSeries(t, store, count)
+
+	series, _ := store.open("agent", "cpu_usage", false)
+	if len(series.sealed) < 2 {
+		t.Fatalf("expected samples to span sealed segments, got %d sealed", len(series.sealed))
+	}
+
+	at := func(i int) time.Time { return historyBase.Add(time.Duration(i) * time.Second) }
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     []int
+	}{
+		{"everything", at(-10), at(100), rangeInts(0, count-1)},
+		{"across segment boundary", at(2), at(7), rangeInts(2, 7)},
+		{"bounds are inclusive", at(3), at(3), []int{3}},
+		{"between samples", at(3).Add(time.Millisecond), at(4).Add(-time.Millisecond), []int{}},
+		{"before first sample", at(-10), at(-1), []int{}},
+		{"after last sample", at(count), at(count + 10), []int{}},
+		{"from after to", at(5), at(2), []int{}},
+		{"first sample only", at(-1), at(0), []int{0}},
+		{"last sample only", at(count - 1), at(count + 1), []int{count - 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples, err := store.query("agent", "cpu_usage", tt.from, tt.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sampleNumbers(t, samples); !slices.Equal(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistoryStoreOrdersOutOfOrderSamples(t *testing.T) {
+	store, err := openHistoryStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.close()
+
+	for _, i := range []int{2, 0, 1} {
+		if err := store.append("agent", "cpu_usage", historyBase.Add(time.Duration(i)*time.Second), bigPayload{N: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	samples, err := store.query("agent", "cpu_usage", historyBase, historyBase.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sampleNumbers(t, samples); !slices.Equal(got, []int{0, 1, 2}) {
+		t.Fatalf("got %v, want [0 1 2]", got)
+	}
+}
+
+func TestHistoryStoreQueryDuringAppends(t *testing.T) {
+	store, err := openHistoryStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pad := strings.Repeat("x", 1<<20)
+		for i := 0; i < 12; i++ {
+			if err := store.append("agent", "cpu_usage", historyBase.Add(time.Duration(i)*time.Second), bigPayload{N: i, Pad: pad}); err != nil {
+				t.Errorf("append %d: %v", i, err)
+				return
+			}
+		}
+	}()
+
+	// Queries run while segments are written and sealed; every sample they
+	// return must be complete and in order.
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		samples, err := store.query("agent", "cpu_usage", historyBase, historyBase.Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := sampleNumbers(t, samples)
+		for i, n := range got {
+			if n != i {
+				t.Fatalf("query during appends returned %v", got)
+			}
+		}
+	}
+}
+
+func TestHistoryStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := openHistoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fillSeries(t, store, 6)
+	before, _ := store.open("agent", "cpu_usage", false)
+	sealed, active := len(before.sealed), before.active
+	if err := store.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := openHistoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.close()
+
+	series, err := reopened.open("agent", "cpu_usage", false)
+	if err != nil || series == nil {
+		t.Fatalf("reopen series: %v", err)
+	}
+	if len(series.sealed) != sealed {
+		t.Fatalf("sealed segments after restart = %d, want %d", len(series.sealed), sealed)
+	}
+	if series.active.Segment != active.Segment || series.active.Count != active.Count || series.active.Bytes != active.Bytes {
+		t.Fatalf("active segment after restart = %+v, want %+v", series.active, active)
+	}
+
+	if err := reopened.append("agent", "cpu_usage", historyBase.Add(6*time.Second), bigPayload{N: 6}); err != nil {
+		t.Fatal(err)
+	}
+	samples, err := reopened.query("agent", "cpu_usage", historyBase, historyBase.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sampleNumbers(t, samples); !slices.Equal(got, rangeInts(0, 6)) {
+		t.Fatalf("got %v, want %v", got, rangeInts(0, 6))
+	}
+}
+
+func TestHistoryStoreRefusesUseAfterClose(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openHistoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.append("agent", "cpu_usage", historyBase, bigPayload{N: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both a series opened before close and a new one are refused.
+	for _, metric := range []string{"cpu_usage", "memory_usage"} {
+		if err := store.append("agent", metric, historyBase.Add(time.Second), bigPayload{N: 1}); !errors.Is(err, errHistoryClosed) {
+			t.Fatalf("append %s after close = %v, want errHistoryClosed", metric, err)
+		}
+		if _, err := store.query("agent", metric, historyBase, historyBase.Add(time.Minute)); !errors.Is(err, errHistoryClosed) {
+			t.Fatalf("query %s after close = %v, want errHistoryClosed", metric, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "agent", "memory_usage")); !os.IsNotExist(err) {
+		t.Fatalf("append after close created a series: %v", err)
+	}
+}
+
+func TestHistoryStoreQueryUnknownCreatesNothing(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openHistoryStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.close()
+
+	samples, err := store.query("ghost", "cpu_usage", historyBase, historyBase.Add(time.Hour))
+	if err != nil || len(samples) != 0 {
+		t.Fatalf("query unknown = %v, %v; want no samples", samples, err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("query created %d entries in the data dir", len(entries))
+	}
+	if len(store.series) != 0 {
+		t.Fatalf("query cached %d series", len(store.series))
+	}
+}
+
+func TestEscapePathPart(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"agent-01", "agent-01"},
+		{"host.example.com", "host.example.com"},
+		{"a_b", "a_b"},
+		{"a/b", "a%2Fb"},
+		{"a%2Fb", "a%252Fb"},
+		{"é", "%C3%A9"},
+		{"", "%"},
+		{".", "%2E"},
+		{"..", "%2E%2E"},
+		{"../x", "..%2Fx"},
+	}
+	seen := make(map[string]string)
+	for _, tt := range tests {
+		got := escapePathPart(tt.in)
+		if got != tt.want {
+			t.Errorf("escapePathPart(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if other, ok := seen[got]; ok {
+			t.Errorf("%q and %q both map to %q", other, tt.in, got)
+		}
+		seen[got] = tt.in
+		if filepath.Base(got) != got || got == "." || got == ".." {
+			t.Errorf("escapePathPart(%q) = %q is not a single path element", tt.in, got)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"libs/protocol"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useHistoryStore points historyDB at a fresh store in a temp dir holding the
+// given cpu_usage samples of client "agent", keyed by offset from historyBase.
+func useHistoryStore(t *testing.T, samples map[time.Duration]float64) {
+	t.Helper()
+	store, err := openHistoryStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := historyDB
+	historyDB = store
+	t.Cleanup(func() {
+		historyDB = saved
+		store.close()
+	})
+
+	for offset, usage := range samples {
+		if err := store.append("agent", "cpu_usage", historyBase.Add(offset), protocol.CpuUsageData{Usage: usage}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// describePoints renders points as "offset=value" relative to historyBase.
+func describePoints(points []protocol.HistoryPoint) string {
+	out := make([]string, 0, len(points))
+	for _, p := range points {
+		out = append(out, fmt.Sprintf("%s=%g", p.Timestamp.Sub(historyBase), p.Value))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestQueryHistoryAggregations(t *testing.T) {
+	useHistoryStore(t, map[time.Duration]float64{
+		0:                       10,
+		time.Second:             20,
+		2500 * time.Millisecond: 30,
+		5 * time.Second:         40,
+		5 * time.Minute:         99, // outside the range
+	})
+
+	tests := []struct {
+		aggregation string
+		want        string
+	}{
+		{"", "0s=15 2s=30 4s=40"},
+		{"avg", "0s=15 2s=30 4s=40"},
+		{"min", "0s=10 2s=30 4s=40"},
+		{"max", "0s=20 2s=30 4s=40"},
+		{"last", "0s=20 2s=30 4s=40"},
+		{"count", "0s=2 2s=1 4s=1"},
+	}
+	for _, tt := range tests {
+		t.Run("aggregation "+tt.aggregation, func(t *testing.T) {
+			resp, err := queryHistory(protocol.HistoryRequestData{
+				ClientID: "agent", Metric: "cpu_usage", Aggregation: tt.aggregation,
+				From: historyBase, To: historyBase.Add(6 * time.Second), StepMs: 2000,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describePoints(resp.Points); got != tt.want {
+				t.Fatalf("points = %s, want %s", got, tt.want)
+			}
+			if resp.Field != "usage" || resp.StepMs != 2000 || (tt.aggregation == "" && resp.Aggregation != "avg") {
+				t.Fatalf("response = field %q step %d aggregation %q", resp.Field, resp.StepMs, resp.Aggregation)
+			}
+		})
+	}
+}
+
+func TestQueryHistoryAlignsBucketsToFrom(t *testing.T) {
+	useHistoryStore(t, map[time.Duration]float64{
+		1400 * time.Millisecond: 1,
+		2100 * time.Millisecond: 2,
+		3300 * time.Millisecond: 3,
+	})
+
+	// Buckets start at from (+0.3s), not at a multiple of the step.
+	resp, err := queryHistory(protocol.HistoryRequestData{
+		ClientID: "agent", Metric: "cpu_usage", Aggregation: "count",
+		From: historyBase.Add(300 * time.Millisecond), To: historyBase.Add(10 * time.Second), StepMs: 2000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := describePoints(resp.Points); got != "300ms=2 2.3s=1" {
+		t.Fatalf("points = %s, want 300ms=2 2.3s=1", got)
+	}
+}
+
+func TestQueryHistoryMinimumStep(t *testing.T) {
+	useHistoryStore(t, map[time.Duration]float64{
+		0:                      1,
+		200 * time.Millisecond: 2,
+		time.Second:            3,
+	})
+
+	resp, err := queryHistory(protocol.HistoryRequestData{
+		ClientID: "agent", Metric: "cpu_usage", Aggregation: "count",
+		From: historyBase, To: historyBase.Add(time.Minute), StepMs: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StepMs != minHistoryStep.Milliseconds() {
+		t.Fatalf("step = %dms, want %dms", resp.StepMs, minHistoryStep.Milliseconds())
+	}
+	if got := describePoints(resp.Points); got != "0s=2 1s=1" {
+		t.Fatalf("points = %s, want 0s=2 1s=1", got)
+	}
+}
+
+func TestQueryHistoryCapsBuckets(t *testing.T) {
+	for _, span := range []time.Duration{
+		maxHistoryPoints * 2 * time.Second,                  // divides evenly
+		maxHistoryPoints*2*time.Second + 7*time.Millisecond, // does not
+		maxHistoryPoints*time.Second - time.Millisecond,     // just under one bucket per second
+		maxHistoryPoints * time.Second,                      // exactly one per second
+		maxHistoryPoints*time.Second + 999*time.Millisecond, // rounds within the millisecond
+	} {
+		t.Run(span.String(), func(t *testing.T) {
+			// Samples at both ends of the inclusive range land in the first
+			// and the last bucket.
+			useHistoryStore(t, map[time.Duration]float64{0: 1, span: 2})
+
+			resp, err := queryHistory(protocol.HistoryRequestData{
+				ClientID: "agent", Metric: "cpu_usage",
+				From: historyBase, To: historyBase.Add(span), StepMs: 1000,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			step := time.Duration(resp.StepMs) * time.Millisecond
+			if buckets := span/step + 1; buckets > maxHistoryPoints {
+				t.Fatalf("step %s splits %s into %d buckets, more than %d", step, span, buckets, maxHistoryPoints)
+			}
+			if len(resp.Points) != 2 {
+				t.Fatalf("got %d points, want 2", len(resp.Points))
+			}
+			if last := resp.Points[1].Timestamp; last.After(historyBase.Add(span)) || last.Sub(historyBase)%step != 0 {
+				t.Fatalf("last bucket starts at %s with step %s", last.Sub(historyBase), step)
+			}
+		})
+	}
+}
+
+func TestQueryHistoryRejectsInvalidRequests(t *testing.T) {
+	useHistoryStore(t, nil)
+
+	valid := protocol.HistoryRequestData{ClientID: "agent", Metric: "cpu_usage", From: historyBase, To: historyBase.Add(time.Minute)}
+	tests := []struct {
+		name   string
+		modify func(req *protocol.HistoryRequestData)
+		want   string
+	}{
+		{"empty range", func(req *protocol.HistoryRequestData) { req.To = req.From }, "invalid range"},
+		{"reversed range", func(req *protocol.HistoryRequestData) { req.From, req.To = req.To, req.From }, "invalid range"},
+		{"no client", func(req *protocol.HistoryRequestData) { req.ClientID = "" }, "client_id is required"},
+		{"unknown aggregation", func(req *protocol.HistoryRequestData) { req.Aggregation = "p99" }, "unknown aggregation"},
+		{"unknown metric", func(req *protocol.HistoryRequestData) { req.Metric = "gpu_usage" }, "gpu_usage"},
+		{"unknown field", func(req *protocol.HistoryRequestData) { req.Field = "temperature" }, "temperature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid
+			tt.modify(&req)
+			if _, err := queryHistory(req); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("defaults to the last hour", func(t *testing.T) {
+		req := valid
+		req.From = time.Time{}
+		resp, err := queryHistory(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.To.Sub(resp.From); got != defaultHistoryRange {
+			t.Fatalf("default range = %s, want %s", got, defaultHistoryRange)
+		}
+	})
+
+	t.Run("storage disabled", func(t *testing.T) {
+		historyDB = nil
+		if _, err := queryHistory(valid); err == nil {
+			t.Fatal("query succeeded without a history store")
+		}
+	})
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"libs/protocol"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// httpServer is the optional REST API (--http); nil when disabled.
+var httpServer *http.Server
+
+// startHTTPServer serves the REST API on addr, over TLS when tlsConfig is set,
+// for tools that do not speak the TCP protocol.
+func startHTTPServer(addr string, tlsConfig *tls.Config) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	httpServer = &http.Server{
+		Handler:           newHTTPHandler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	httpServer.RegisterOnShutdown(closeEventStreams)
+	go func() {
+		if err := httpServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Println("❌ HTTP API stopped:", err)
+		}
+	}()
+
+	fmt.Printf("🌐 HTTP API listening on %s\n", addr)
+	return nil
+}
+
+// stopHTTPServer lets in-flight requests finish, up to timeout.
+func stopHTTPServer(timeout time.Duration) {
+	if httpServer == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := httpServer.Shutdown(ctx); err != nil {
+		fmt.Println("❌ Error stopping HTTP API:", err)
+	}
+}
+
+// newHTTPHandler routes the REST API. Reads need a monitor token with any
+// access; changing a client's interval needs admin access, as over TCP.
+func newHTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /clients", requireAccess("", handleHTTPClients))
+	mux.HandleFunc("GET /clients/{id}", requireAccess("", handleHTTPClient))
+	mux.HandleFunc("GET /clients/{id}/history", requireAccess("", handleHTTPHistory))
+	mux.HandleFunc("POST /clients/{id}/interval", requireAccess(accessAdmin, handleHTTPInterval))
+	mux.HandleFunc("GET /metrics", requireAccess("", handleHTTPMetrics))
+	mux.HandleFunc("GET /events", requireAccess("", handleHTTPEvents))
+	// Browsers cannot set headers on WebSockets: the token goes in the handshake.
+	mux.HandleFunc("GET /ws", handleWebSocket)
+	mux.Handle("GET /", dashboardHandler())
+	return mux
+}
+
+// requireAccess authenticates the request's bearer token against the monitor
+// credentials before calling next.
+func requireAccess(level string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		access, err := authenticateToken(bearerToken(r))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeHTTPError(w, http.StatusUnauthorized, protocol.ErrorForbidden, err.Error())
+			return
+		}
+		if level == accessAdmin && access != accessAdmin {
+			writeHTTPError(w, http.StatusForbidden, protocol.ErrorForbidden, "admin access required")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// bearerToken extracts the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// handleHTTPClients lists every connected client, sorted by client ID.
+func handleHTTPClients(w http.ResponseWriter, r *http.Request) {
+	summaries := collectClientSummaries()
+	slices.SortFunc(summaries, func(a, b protocol.ClientStateSummary) int {
+		return strings.Compare(summaryClientID(a), summaryClientID(b))
+	})
+	writeJSON(w, http.StatusOK, summaries)
+}
+
+// handleHTTPClient returns one connected client.
+func handleHTTPClient(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	for _, summary := range collectClientSummaries() {
+		if summaryClientID(summary) == id {
+			writeJSON(w, http.StatusOK, summary)
+			return
+		}
+	}
+	writeHTTPError(w, http.StatusNotFound, protocol.ErrorNotFound, fmt.Sprintf("client %s not connected", id))
+}
+
+// handleHTTPHistory answers a history query. The parameters mirror
+// history_request: metric, field, from and to (RFC 3339), step (a duration
+// such as 30s or 5m) and aggregation. Disconnected clients can be queried too.
+func handleHTTPHistory(w http.ResponseWriter, r *http.Request) {
+	if historyDB == nil {
+		writeHTTPError(w, http.StatusServiceUnavailable, protocol.ErrorInternal, "history storage is disabled")
+		return
+	}
+
+	query := r.URL.Query()
+	req := protocol.HistoryRequestData{
+		ClientID:    r.PathValue("id"),
+		Metric:      query.Get("metric"),
+		Field:       query.Get("field"),
+		Aggregation: query.Get("aggregation"),
+	}
+
+	var err error
+	if req.From, err = parseTimeParam(query.Get("from")); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, protocol.ErrorInvalidRequest, fmt.Sprintf("invalid from: %v", err))
+		return
+	}
+	if req.To, err = parseTimeParam(query.Get("to")); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, protocol.ErrorInvalidRequest, fmt.Sprintf("invalid to: %v", err))
+		return
+	}
+	if step := query.Get("step"); step != "" {
+		d, err := time.ParseDuration(step)
+		if err != nil {
+			writeHTTPError(w, http.StatusBadRequest, protocol.ErrorInvalidRequest, fmt.Sprintf("invalid step: %v", err))
+			return
+		}
+		req.StepMs = d.Milliseconds()
+	}
+
+	resp, err := queryHistory(req)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, protocol.ErrorInvalidRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleHTTPInterval asks a client to change its stats interval. The body is
+// {"interval_ms": N}; the change is confirmed later by the client's
+// interval_update, so the request is answered with 202 Accepted.
+func handleHTTPInterval(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	var body protocol.IntervalUpdateData
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&body); err != nil {
+		writeHTTPError(w, http.StatusBadRequest, protocol.ErrorInvalidPayload, fmt.Sprintf("invalid body: %v", err))
+		return
+	}
+	if body.IntervalMs <= 0 {
+		writeHTTPError(w, http.StatusBadRequest, protocol.ErrorInvalidRequest, "a positive interval_ms is required")
+		return
+	}
+
+	if err := sendIntervalSet(id, body.IntervalMs); err != nil {
+		if errors.Is(err, errClientNotConnected) {
+			writeHTTPError(w, http.StatusNotFound, protocol.ErrorNotFound, fmt.Sprintf("client %s not connected", id))
+			return
+		}
+		writeHTTPError(w, http.StatusBadGateway, protocol.ErrorInternal, fmt.Sprintf("sending interval to client: %v", err))
+		return
+	}
+
+	fmt.Printf("🌐 Interval %dms requested for %s via HTTP from %s\n", body.IntervalMs, id, r.RemoteAddr)
+	writeJSON(w, http.StatusAccepted, protocol.IntervalUpdateData{ClientID: id, IntervalMs: body.IntervalMs})
+}
+
+// parseTimeParam reads an optional RFC 3339 timestamp.
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// writeJSON sends v as the JSON response body.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Println("❌ Error writing HTTP response:", err)
+	}
+}
+
+// writeHTTPError reports a failure with the same ErrorData used over TCP.
+func writeHTTPError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, protocol.ErrorData{Code: code, Message: message})
+}
@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
+	"libs/utils"
 	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 )
 
@@ -14,8 +21,62 @@ const defaultStatsInterval = 5 * time.Second
 func main() {
 	// Parse command-line flags before starting the server.
 	port := flag.Int("port", 8080, "TCP port to listen on")
+	dataDir := flag.String("data-dir", "data", "Directory for persisted metric history (empty disables it)")
+	rulesPath := flag.String("alert-rules", "", "JSON file with alert rules evaluated on every client update")
+	authFile := flag.String("auth-file", "", "JSON file with the tokens accepted in the handshake (empty disables authentication)")
+	duplicateID := flag.String("duplicate-id", duplicateReject, "What to do when a client handshakes with an ID already in use: reject (the new one), kick (the old one) or suffix (assign <id>-N)")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate for TLS (enables TLS together with --tls-key)")
+	tlsKey := flag.String("tls-key", "", "PEM private key for TLS")
+	tlsClientCA := flag.String("tls-client-ca", "", "CA used to verify client certificates; agents must then present one issued for their client_id")
+	httpAddr := flag.String("http", "", "Address for the HTTP REST API, e.g. :8081 (empty disables it)")
+	wsOrigins := flag.String("ws-allowed-origins", "", "Comma separated origins, e.g. https://painel.example.com, allowed to open /ws besides the server's own address")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 10*time.Second, "How long to wait for peers to disconnect on SIGINT/SIGTERM before closing them")
+	flag.DurationVar(&heartbeatInterval, "heartbeat", heartbeatInterval, "How often to ping peers; silent peers are dropped after 3 intervals (0 disables)")
 	flag.Parse()
 
+	// Open the on-disk history before accepting agents so no sample is lost.
+	if *dataDir != "" {
+		store, err := openHistoryStore(*dataDir)
+		if err != nil {
+			panic(err)
+		}
+		historyDB = store
+		fmt.Printf("🗄️  Storing metric history in %s\n", *dataDir)
+	}
+
+	if *rulesPath != "" {
+		rules, err := loadAlertRules(*rulesPath)
+		if err != nil {
+			panic(err)
+		}
+		setAlertRules(rules)
+		fmt.Printf("🔔 Loaded %d alert rule(s) from %s\n", len(rules), *rulesPath)
+	}
+
+	switch *duplicateID {
+	case duplicateReject, duplicateKick, duplicateSuffix:
+		duplicateIDPolicy = *duplicateID
+	default:
+		panic(fmt.Sprintf("unknown --duplicate-id policy %q", *duplicateID))
+	}
+
+	for _, origin := range strings.Split(*wsOrigins, ",") {
+		if origin = strings.TrimSuffix(strings.TrimSpace(origin), "/"); origin != "" {
+			wsAllowedOrigins = append(wsAllowedOrigins, origin)
+		}
+	}
+
+	if *authFile != "" {
+		creds, err := loadCredentials(*authFile)
+		if err != nil {
+			panic(err)
+		}
+		authCredentials = creds
+		fmt.Printf("🔑 Loaded %d credential(s) from %s\n", len(creds), *authFile)
+	}
+
+	go watchClientHealth()
+
 	addr := fmt.Sprintf(":%d", *port)
 
 	// Start listening for TCP connections on the requested port.
@@ -23,18 +84,58 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+
+	var tlsConfig *tls.Config
+	if *tlsCert != "" || *tlsKey != "" {
+		tlsConfig, err = utils.ServerTLSConfig(*tlsCert, *tlsKey, *tlsClientCA)
+		if err != nil {
+			panic(err)
+		}
+		ln = tls.NewListener(ln, tlsConfig)
+		requireAgentCerts = *tlsClientCA != ""
+		fmt.Printf("🔒 TLS enabled (client certificates required for agents: %t)\n", requireAgentCerts)
+	} else if *tlsClientCA != "" {
+		panic("--tls-client-ca requires --tls-cert and --tls-key")
+	}
 	fmt.Printf("🚀 TCP server listening on %s...\n", addr)
 
-	// Accept connections indefinitely, delegating the handling to a goroutine
-	// so multiple clients can talk to the server at once.
+	// The HTTP API shares the TLS certificate of the TCP listener.
+	if *httpAddr != "" {
+		if err := startHTTPServer(*httpAddr, tlsConfig); err != nil {
+			panic(err)
+		}
+	}
+
+	// SIGINT/SIGTERM close the listener, which ends the accept loop below.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	// Accept connections until asked to stop, delegating the handling to a
+	// goroutine so multiple clients can talk to the server at once.
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
 			fmt.Println("❌ Error accepting connection:", err)
 			continue
 		}
-		go handleConnection(conn)
+		if !trackConnection() {
+			conn.Close()
+			break
+		}
+		go serveConnection(conn)
 	}
+
+	// From here on a second signal kills the process right away.
+	stop()
+	fmt.Println("🛑 Shutting down: no longer accepting connections")
+	shutdown(*shutdownTimeout)
 }
 
 // Código gerado com auxílio de IA.
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"libs/protocol"
+	"sort"
+)
+
+// metricDef describes a numeric metric sent by the agents. Registering it is
+// enough for the server to keep the latest sample in the client state, persist
+// it to the history, answer history queries and evaluate alert rules on it.
+type metricDef[T any] struct {
+	// Type is the message type and the metric name used by queries and rules.
+	Type string
+	// Label and Describe build the log line printed for every sample.
+	Label    string
+	Describe func(data *T) string
+	// DefaultField is used when a query or rule does not choose a field.
+	DefaultField string
+	// Fields maps the JSON field names to their numeric value.
+	Fields map[string]func(data *T) float64
+	// Store saves the sample in the client state; Current reads it back.
+	Store   func(state *ClientState, data *T)
+	Current func(summary protocol.ClientStateSummary) *T
+}
+
+// metricSpec is the untyped view of a metricDef used by history and alerts.
+type metricSpec struct {
+	defaultField string
+	fields       []string
+	value        func(field string, payload interface{}) (float64, bool)
+	current      func(summary protocol.ClientStateSummary) interface{}
+}
+
+var metricSpecs = make(map[string]*metricSpec)
+
+// registerMetric registers the message handler and the history/alert view of
+// a metric. Like registerHandler, it is meant to be called from init.
+func registerMetric[T any](def metricDef[T]) {
+	if _, ok := def.Fields[def.DefaultField]; !ok {
+		panic(fmt.Sprintf("registerMetric: %s has no field %q", def.Type, def.DefaultField))
+	}
+
+	fields := make([]string, 0, len(def.Fields))
+	for name := range def.Fields {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+
+	metricSpecs[def.Type] = &metricSpec{
+		defaultField: def.DefaultField,
+		fields:       fields,
+		value: func(field string, payload interface{}) (float64, bool) {
+			data, ok := payload.(*T)
+			extract, known := def.Fields[field]
+			if !ok || data == nil || !known {
+				return 0, false
+			}
+			return extract(data), true
+		},
+		current: func(summary protocol.ClientStateSummary) interface{} {
+			if data := def.Current(summary); data != nil {
+				return data
+			}
+			return nil
+		},
+	}
+
+	registerHandler(messageHandler{
+		Type:       def.Type,
+		NewPayload: func() interface{} { return new(T) },
+		Roles:      []string{"client"},
+		Handle: func(ctx *messageContext) error {
+			data := ctx.msg.Data.(*T)
+			state := updateClientState(ctx.remote, ctx.at, func(state *ClientState) {
+				def.Store(state, data)
+			})
+			recordHistory(state, def.Type, ctx.at, data)
+			evaluateAlerts(state)
+			fmt.Printf("%s from %s: %s\n", def.Label, ctx.remote, def.Describe(data))
+			broadcastClientUpdate(state)
+			debugState(ctx.remote, state)
+			return nil
+		},
+	})
+}
+
+// lookupMetric returns the registered metric with the given name.
+func lookupMetric(metric string) (*metricSpec, bool) {
+	spec, ok := metricSpecs[metric]
+	return spec, ok
+}
+
+// resolveMetricField validates the metric and field names, filling in the
+// default field when none is given.
+func resolveMetricField(metric, field string) (string, error) {
+	spec, ok := lookupMetric(metric)
+	if !ok {
+		return "", fmt.Errorf("unknown metric %q", metric)
+	}
+	if field == "" {
+		return spec.defaultField, nil
+	}
+	for _, name := range spec.fields {
+		if name == field {
+			return field, nil
+		}
+	}
+	return "", fmt.Errorf("unknown field %q for metric %s", field, metric)
+}
+
+// decodeMetricPayload converts a stored raw sample back into its typed payload.
+func decodeMetricPayload(metric string, raw json.RawMessage) (interface{}, error) {
+	if _, ok := lookupMetric(metric); !ok {
+		return nil, fmt.Errorf("unknown metric %q", metric)
+	}
+	payload, ok := protocol.NewPayload(metric)
+	if !ok {
+		return nil, fmt.Errorf("unknown metric %q", metric)
+	}
+
+	if err := json.Unmarshal(raw, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// metricValue extracts a numeric field from a typed metric payload. The field
+// names match the JSON names used in the protocol.
+func metricValue(metric, field string, payload interface{}) (float64, bool) {
+	spec, ok := lookupMetric(metric)
+	if !ok {
+		return 0, false
+	}
+	return spec.value(field, payload)
+}
+
+// currentMetric returns the latest payload of a metric stored in a summary,
+// or nil when the client has not reported it yet.
+func currentMetric(summary protocol.ClientStateSummary, metric string) interface{} {
+	spec, ok := lookupMetric(metric)
+	if !ok {
+		return nil
+	}
+	return spec.current(summary)
+}
+
+func init() {
+	registerMetric(metricDef[protocol.CpuUsageData]{
+		Type:         "cpu_usage",
+		Label:        "📈 CPU update",
+		Describe:     func(cpu *protocol.CpuUsageData) string { return fmt.Sprintf("total %.2f%%", cpu.Usage) },
+		DefaultField: "usage",
+		Fields: map[string]func(*protocol.CpuUsageData) float64{
+			"usage": func(cpu *protocol.CpuUsageData) float64 { return cpu.Usage },
+		},
+		Store:   func(state *ClientState, cpu *protocol.CpuUsageData) { state.CPU = cpu },
+		Current: func(summary protocol.ClientStateSummary) *protocol.CpuUsageData { return summary.CPU },
+	})
+
+	registerMetric(metricDef[protocol.MemoryUsageData]{
+		Type:         "memory_usage",
+		Label:        "🧠 Memory update",
+		Describe:     func(mem *protocol.MemoryUsageData) string { return fmt.Sprintf("used %.2f%%", mem.UsedPercent) },
+		DefaultField: "used_percent",
+		Fields: map[string]func(*protocol.MemoryUsageData) float64{
+			"used_percent": func(mem *protocol.MemoryUsageData) float64 { return mem.UsedPercent },
+			"used":         func(mem *protocol.MemoryUsageData) float64 { return float64(mem.Used) },
+			"total":        func(mem *protocol.MemoryUsageData) float64 { return float64(mem.Total) },
+		},
+		Store:   func(state *ClientState, mem *protocol.MemoryUsageData) { state.Memory = mem },
+		Current: func(summary protocol.ClientStateSummary) *protocol.MemoryUsageData { return summary.Memory },
+	})
+
+	registerMetric(metricDef[protocol.SystemLoadData]{
+		Type:  "system_load",
+		Label: "⚖️ Load update",
+		Describe: func(load *protocol.SystemLoadData) string {
+			return fmt.Sprintf("load %.2f %.2f %.2f, swap %.2f%%", load.Load1, load.Load5, load.Load15, load.SwapUsedPercent)
+		},
+		DefaultField: "load1",
+		Fields: map[string]func(*protocol.SystemLoadData) float64{
+			"load1":                    func(load *protocol.SystemLoadData) float64 { return load.Load1 },
+			"load5":                    func(load *protocol.SystemLoadData) float64 { return load.Load5 },
+			"load15":                   func(load *protocol.SystemLoadData) float64 { return load.Load15 },
+			"swap_used":                func(load *protocol.SystemLoadData) float64 { return float64(load.SwapUsed) },
+			"swap_used_percent":        func(load *protocol.SystemLoadData) float64 { return load.SwapUsedPercent },
+			"context_switches_per_sec": func(load *protocol.SystemLoadData) float64 { return load.ContextSwitchesPerSec },
+			"procs_running":            func(load *protocol.SystemLoadData) float64 { return float64(load.ProcsRunning) },
+			"procs_blocked":            func(load *protocol.SystemLoadData) float64 { return float64(load.ProcsBlocked) },
+		},
+		Store:   func(state *ClientState, load *protocol.SystemLoadData) { state.Load = load },
+		Current: func(summary protocol.ClientStateSummary) *protocol.SystemLoadData { return summary.Load },
+	})
+
+	registerMetric(metricDef[protocol.DiskUsageData]{
+		Type:         "disk_usage",
+		Label:        "💾 Disk update",
+		Describe:     func(disk *protocol.DiskUsageData) string { return fmt.Sprintf("used %.2f%%", disk.UsedPercent) },
+		DefaultField: "used_percent",
+		Fields: map[string]func(*protocol.DiskUsageData) float64{
+			"used_percent": func(disk *protocol.DiskUsageData) float64 { return disk.UsedPercent },
+			"used":         func(disk *protocol.DiskUsageData) float64 { return float64(disk.Used) },
+			"free":         func(disk *protocol.DiskUsageData) float64 { return float64(disk.Free) },
+			"total":        func(disk *protocol.DiskUsageData) float64 { return float64(disk.Total) },
+			"max_used_percent": func(disk *protocol.DiskUsageData) float64 {
+				return mountMax(disk, func(m protocol.MountUsage) float64 { return m.UsedPercent })
+			},
+			"max_inodes_used_percent": func(disk *protocol.DiskUsageData) float64 {
+				return mountMax(disk, func(m protocol.MountUsage) float64 { return m.InodesUsedPercent })
+			},
+		},
+		Store:   func(state *ClientState, disk *protocol.DiskUsageData) { state.Disk = disk },
+		Current: func(summary protocol.ClientStateSummary) *protocol.DiskUsageData { return summary.Disk },
+	})
+
+	registerMetric(metricDef[protocol.DiskIOData]{
+		Type:  "disk_io",
+		Label: "💽 Disk I/O update",
+		Describe: func(io *protocol.DiskIOData) string {
+			return fmt.Sprintf("%d devices, read %.0f B/s, write %.0f B/s", len(io.Devices),
+				diskIOTotal(io, func(d protocol.DiskDeviceIO) float64 { return d.ReadBytesPerSec }),
+				diskIOTotal(io, func(d protocol.DiskDeviceIO) float64 { return d.WriteBytesPerSec }))
+		},
+		DefaultField: "bytes_per_sec",
+		Fields: map[string]func(*protocol.DiskIOData) float64{
+			"bytes_per_sec": func(io *protocol.DiskIOData) float64 {
+				return diskIOTotal(io, func(d protocol.DiskDeviceIO) float64 { return d.ReadBytesPerSec + d.WriteBytesPerSec })
+			},
+			"read_bytes_per_sec": func(io *protocol.DiskIOData) float64 {
+				return diskIOTotal(io, func(d protocol.DiskDeviceIO) float64 { return d.ReadBytesPerSec })
+			},
+			"write_bytes_per_sec": func(io *protocol.DiskIOData) float64 {
+				return diskIOTotal(io, func(d protocol.DiskDeviceIO) float64 { return d.WriteBytesPerSec })
+			},
+			"reads_per_sec": func(io *protocol.DiskIOData) float64 {
+				return diskIOTotal(io, func(d protocol.DiskDeviceIO) float64 { return d.ReadsPerSec })
+			},
+			"writes_per_sec": func(io *protocol.DiskIOData) float64 {
+				return diskIOTotal(io, func(d protocol.DiskDeviceIO) float64 { return d.WritesPerSec })
+			},
+			"max_busy_percent": func(io *protocol.DiskIOData) float64 {
+				var busiest float64
+				for _, d := range io.Devices {
+					busiest = max(busiest, d.BusyPercent)
+				}
+				return busiest
+			},
+		},
+		Store:   func(state *ClientState, io *protocol.DiskIOData) { state.DiskIO = io },
+		Current: func(summary protocol.ClientStateSummary) *protocol.DiskIOData { return summary.DiskIO },
+	})
+
+	registerMetric(metricDef[protocol.ProcessUsageData]{
+		Type:         "process_usage",
+		Label:        "📊 Process update",
+		Describe:     func(proc *protocol.ProcessUsageData) string { return fmt.Sprintf("%d entries", len(proc.Processes)) },
+		DefaultField: "cpu_percent",
+		Fields: map[string]func(*protocol.ProcessUsageData) float64{
+			"cpu_percent": func(proc *protocol.ProcessUsageData) float64 {
+				var total float64
+				for _, p := range proc.Processes {
+					total += p.CPUPercent
+				}
+				return total
+			},
+			"count": func(proc *protocol.ProcessUsageData) float64 { return float64(len(proc.Processes)) },
+		},
+		Store:   func(state *ClientState, proc *protocol.ProcessUsageData) { state.Processes = proc },
+		Current: func(summary protocol.ClientStateSummary) *protocol.ProcessUsageData { return summary.Processes },
+	})
+
+	registerMetric(metricDef[protocol.NetworkUsageData]{
+		Type:  "network_usage",
+		Label: "🌐 Network update",
+		Describe: func(network *protocol.NetworkUsageData) string {
+			return fmt.Sprintf("%d interfaces, in %.0f B/s, out %.0f B/s", len(network.Interfaces),
+				networkTotal(network, func(i protocol.NetworkInterfaceUsage) float64 { return i.BytesInPerSec }),
+				networkTotal(network, func(i protocol.NetworkInterfaceUsage) float64 { return i.BytesOutPerSec }))
+		},
+		DefaultField: "bytes_per_sec",
+		Fields: map[string]func(*protocol.NetworkUsageData) float64{
+			"bytes_per_sec": func(network *protocol.NetworkUsageData) float64 {
+				return networkTotal(network, func(i protocol.NetworkInterfaceUsage) float64 { return i.BytesInPerSec + i.BytesOutPerSec })
+			},
+			"bytes_in_per_sec": func(network *protocol.NetworkUsageData) float64 {
+				return networkTotal(network, func(i protocol.NetworkInterfaceUsage) float64 { return i.BytesInPerSec })
+			},
+			"bytes_out_per_sec": func(network *protocol.NetworkUsageData) float64 {
+				return networkTotal(network, func(i protocol.NetworkInterfaceUsage) float64 { return i.BytesOutPerSec })
+			},
+			"packets_in_per_sec": func(network *protocol.NetworkUsageData) float64 {
+				return networkTotal(network, func(i protocol.NetworkInterfaceUsage) float64 { return i.PacketsInPerSec })
+			},
+			"packets_out_per_sec": func(network *protocol.NetworkUsageData) float64 {
+				return networkTotal(network, func(i protocol.NetworkInterfaceUsage) float64 { return i.PacketsOutPerSec })
+			},
+			"errors_per_sec": func(network *protocol.NetworkUsageData) float64 {
+				return networkTotal(network, func(i protocol.NetworkInterfaceUsage) float64 { return i.ErrorsInPerSec + i.ErrorsOutPerSec })
+			},
+			"drops_per_sec": func(network *protocol.NetworkUsageData) float64 {
+				return networkTotal(network, func(i protocol.NetworkInterfaceUsage) float64 { return i.DropsInPerSec + i.DropsOutPerSec })
+			},
+		},
+		Store:   func(state *ClientState, network *protocol.NetworkUsageData) { state.Network = network },
+		Current: func(summary protocol.ClientStateSummary) *protocol.NetworkUsageData { return summary.Network },
+	})
+}
+
+// mountMax returns the highest value of a per-mount percentage, falling back
+// to the root volume for agents that do not report mounts.
+func mountMax(disk *protocol.DiskUsageData, value func(protocol.MountUsage) float64) float64 {
+	if len(disk.Mounts) == 0 {
+		return value(protocol.MountUsage{UsedPercent: disk.UsedPercent})
+	}
+	var highest float64
+	for _, m := range disk.Mounts {
+		highest = max(highest, value(m))
+	}
+	return highest
+}
+
+// diskIOTotal sums a per-device rate over all the reported devices.
+func diskIOTotal(io *protocol.DiskIOData, rate func(protocol.DiskDeviceIO) float64) float64 {
+	var total float64
+	for _, d := range io.Devices {
+		total += rate(d)
+	}
+	return total
+}
+
+// networkTotal sums a per-interface rate over all the reported interfaces.
+func networkTotal(network *protocol.NetworkUsageData, rate func(protocol.NetworkInterfaceUsage) float64) float64 {
+	var total float64
+	for _, iface := range network.Interfaces {
+		total += rate(iface)
+	}
+	return total
+}
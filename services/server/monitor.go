@@ -1,7 +1,7 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"libs/protocol"
 	"net"
@@ -9,52 +9,206 @@ import (
 	"time"
 )
 
+// Monitors are written to by a dedicated goroutine each, so a slow monitor
+// never blocks the goroutines ingesting client metrics. Messages wait in a
+// bounded queue; a monitor with monitorQueueSize messages pending is too far
+// behind and gets disconnected, as does one whose socket accepts no data for
+// monitorWriteTimeout.
+const (
+	monitorQueueSize    = 256
+	monitorWriteTimeout = 10 * time.Second
+)
+
 // MonitorConn represents a watcher client that receives aggregated updates
 // about the monitored agents.
 type MonitorConn struct {
 	remote string
+	id     string
 	conn   net.Conn
-	enc    *json.Encoder
-	mu     sync.Mutex
+
+	mu    sync.Mutex
+	queue []protocol.Message
+	// updates maps a client_id to the index of its pending client_update in
+	// queue, so newer snapshots replace it instead of piling up.
+	updates map[string]int
+	closed  bool
+	wake    chan struct{}
+
+	// seq is only touched by the writer goroutine.
+	seq uint64
 }
 
+// errClientNotConnected is returned when a command targets an unknown client.
+var errClientNotConnected = errors.New("client not connected")
+
+var (
+	errMonitorClosed  = errors.New("monitor connection closed")
+	errMonitorLagging = errors.New("monitor send queue full")
+)
+
 var (
 	monitorMu sync.Mutex
 	monitors  = make(map[string]*MonitorConn)
 )
 
-// send pushes a protocol message to the monitor guarding the encoder with a
-// mutex so concurrent broadcasts stay serialized.
+// send queues a protocol message for the monitor without waiting for the
+// network. A client_update replaces the one still pending for the same client,
+// keeping its place in the queue. When the queue is full the monitor is
+// disconnected.
 func (m *MonitorConn) send(msg protocol.Message) error {
+	if msg.Timestamp.IsZero() {
+		msg.Timestamp = time.Now()
+	}
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	return m.enc.Encode(msg)
+
+	if m.closed {
+		return errMonitorClosed
+	}
+
+	full := len(m.queue) >= monitorQueueSize
+	switch data := msg.Data.(type) {
+	case protocol.ClientUpdateData:
+		key := summaryClientID(data.Client)
+		if i, ok := m.updates[key]; ok {
+			m.queue[i] = msg
+			return nil
+		}
+		if !full {
+			m.updates[key] = len(m.queue)
+		}
+	case protocol.ClientRemovedData:
+		// A later update for a reconnected client must come after the removal.
+		delete(m.updates, data.ClientID)
+	}
+
+	if full {
+		fmt.Printf("🐌 Disconnecting monitor %s: %d messages pending\n", m.remote, len(m.queue))
+		m.closeLocked()
+		return errMonitorLagging
+	}
+
+	m.queue = append(m.queue, msg)
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// writeLoop delivers the queued messages in order, stamping the sequence
+// numbers as they hit the wire. It stops when the monitor is closed or a write
+// fails.
+func (m *MonitorConn) writeLoop() {
+	for range m.wake {
+		for _, msg := range m.takeQueued() {
+			if err := m.write(msg); err != nil {
+				fmt.Printf("❌ Error sending to monitor %s: %v\n", m.remote, err)
+				m.close()
+				return
+			}
+		}
+	}
 }
 
-// registerMonitor stores a monitor connection so it can receive broadcasts.
-func registerMonitor(remote string, conn net.Conn) *MonitorConn {
+// takeQueued empties the queue, returning what was pending.
+func (m *MonitorConn) takeQueued() []protocol.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil
+	}
+	batch := m.queue
+	m.queue = nil
+	clear(m.updates)
+	return batch
+}
+
+// write serializes one message onto the socket, bounded by
+// monitorWriteTimeout.
+func (m *MonitorConn) write(msg protocol.Message) error {
+	m.seq++
+	msg.Seq = m.seq
+	payload, err := protocol.Encode(msg)
+	if err != nil {
+		return err
+	}
+	if err := m.conn.SetWriteDeadline(time.Now().Add(monitorWriteTimeout)); err != nil {
+		return err
+	}
+	_, err = m.conn.Write(payload)
+	return err
+}
+
+// close stops the writer and closes the socket, which also ends the monitor's
+// connection handler.
+func (m *MonitorConn) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closeLocked()
+}
+
+func (m *MonitorConn) closeLocked() {
+	if m.closed {
+		return
+	}
+	m.closed = true
+	m.queue = nil
+	close(m.wake)
+	m.conn.Close()
+}
+
+// summaryClientID identifies the client a summary describes.
+func summaryClientID(summary protocol.ClientStateSummary) string {
+	if summary.Handshake != nil && summary.Handshake.ClientID != "" {
+		return summary.Handshake.ClientID
+	}
+	return summary.RemoteAddr
+}
+
+// registerMonitor stores a monitor connection so it can receive broadcasts and
+// starts its writer. The handshake ID identifies the monitor in
+// acknowledgements, falling back to the remote address when the monitor did
+// not send one. A monitor already registered for remote is closed first so its
+// writer does not outlive the entry.
+func registerMonitor(remote, id string, conn net.Conn) *MonitorConn {
 	monitorMu.Lock()
 	defer monitorMu.Unlock()
 
+	if id == "" {
+		id = remote
+	}
+	if old, ok := monitors[remote]; ok {
+		old.close()
+	}
+
 	mon := &MonitorConn{
-		remote: remote,
-		conn:   conn,
-		enc:    json.NewEncoder(conn),
+		remote:  remote,
+		id:      id,
+		conn:    conn,
+		updates: make(map[string]int),
+		wake:    make(chan struct{}, 1),
 	}
+	go mon.writeLoop()
 
 	monitors[remote] = mon
 	return mon
 }
 
-// unregisterMonitor forgets a monitor that went offline.
+// unregisterMonitor forgets a monitor that went offline and stops its writer.
 func unregisterMonitor(remote string) {
 	monitorMu.Lock()
 	defer monitorMu.Unlock()
-	delete(monitors, remote)
+	if mon, ok := monitors[remote]; ok {
+		mon.close()
+		delete(monitors, remote)
+	}
 }
 
 // snapshotMonitors returns a copy of the current monitor list so broadcasts can
-// happen without holding the global mutex while sending over the network.
+// happen without holding the global mutex while queueing.
 func snapshotMonitors() []*MonitorConn {
 	monitorMu.Lock()
 	defer monitorMu.Unlock()
@@ -83,9 +237,11 @@ func sendClientsState(mon *MonitorConn) error {
 	return mon.send(msg)
 }
 
-// broadcastToMonitors fans a message out to every monitor, logging failures but
-// keeping the broadcast going for the remaining recipients.
+// broadcastToMonitors queues a message for every monitor, logging failures but
+// keeping the broadcast going for the remaining recipients. It never waits on
+// the network. Client and alert events also go to the SSE stream.
 func broadcastToMonitors(msg protocol.Message) {
+	publishEvent(msg)
 	for _, mon := range snapshotMonitors() {
 		if err := mon.send(msg); err != nil {
 			fmt.Printf("❌ Error sending to monitor %s: %v\n", mon.remote, err)
@@ -128,7 +284,7 @@ func broadcastClientRemoved(clientID string) {
 func sendIntervalSet(clientID string, intervalMs int64) error {
 	cc, ok := getClientConnByID(clientID)
 	if !ok {
-		return fmt.Errorf("client %s not connected", clientID)
+		return fmt.Errorf("%w: %s", errClientNotConnected, clientID)
 	}
 
 	msg := protocol.Message{
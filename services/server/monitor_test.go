@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"libs/protocol"
+	"net"
+	"testing"
+	"time"
+)
+
+// newTestMonitor builds a monitor without registering it or starting its
+// writer; peer is the other end of its connection.
+func newTestMonitor(t *testing.T) (*MonitorConn, net.Conn) {
+	t.Helper()
+	server, peer := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		peer.Close()
+	})
+	return &MonitorConn{
+		remote:  "monitor-test",
+		id:      "monitor-test",
+		conn:    server,
+		updates: make(map[string]int),
+		wake:    make(chan struct{}, 1),
+	}, peer
+}
+
+func clientUpdate(clientID string, usage float64) protocol.Message {
+	return protocol.Message{
+		Type: "client_update",
+		Data: protocol.ClientUpdateData{Client: protocol.ClientStateSummary{
+			RemoteAddr: "10.0.0.1:1234",
+			Handshake:  &protocol.HandshakeData{ClientID: clientID},
+			CPU:        &protocol.CpuUsageData{Usage: usage},
+		}},
+	}
+}
+
+// describeQueue renders the queue as "type:client:usage" entries.
+func describeQueue(queue []protocol.Message) []string {
+	out := make([]string, 0, len(queue))
+	for _, msg := range queue {
+		switch data := msg.Data.(type) {
+		case protocol.ClientUpdateData:
+			out = append(out, fmt.Sprintf("update:%s:%.0f", summaryClientID(data.Client), data.Client.CPU.Usage))
+		case protocol.ClientRemovedData:
+			out = append(out, "removed:"+data.ClientID)
+		default:
+			out = append(out, msg.Type)
+		}
+	}
+	return out
+}
+
+func TestMonitorSendCoalescesClientUpdates(t *testing.T) {
+	tests := []struct {
+		name string
+		msgs []protocol.Message
+		want []string
+	}{
+		{
+			name: "latest update per client keeps its place",
+			msgs: []protocol.Message{clientUpdate("a", 1), clientUpdate("b", 2), clientUpdate("a", 3)},
+			want: []string{"update:a:3", "update:b:2"},
+		},
+		{
+			name: "other messages are never coalesced",
+			msgs: []protocol.Message{{Type: "alert", Data: protocol.AlertData{}}, {Type: "alert", Data: protocol.AlertData{}}, clientUpdate("a", 1)},
+			want: []string{"alert", "alert", "update:a:1"},
+		},
+		{
+			name: "removal keeps later updates after it",
+			msgs: []protocol.Message{
+				clientUpdate("a", 1),
+				{Type: "client_removed", Data: protocol.ClientRemovedData{ClientID: "a"}},
+				clientUpdate("a", 2),
+				clientUpdate("a", 3),
+			},
+			want: []string{"update:a:1", "removed:a", "update:a:3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mon, _ := newTestMonitor(t)
+			for _, msg := range tt.msgs {
+				if err := mon.send(msg); err != nil {
+					t.Fatalf("send: %v", err)
+				}
+			}
+			got := describeQueue(mon.takeQueued())
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("queue = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMonitorTakeQueuedResetsCoalescing(t *testing.T) {
+	mon, _ := newTestMonitor(t)
+	mon.send(clientUpdate("a", 1))
+	if got := describeQueue(mon.takeQueued()); fmt.Sprint(got) != "[update:a:1]" {
+		t.Fatalf("first batch = %v", got)
+	}
+
+	// The previous update is on the wire: a new one must be queued, not merged
+	// into a slot that no longer exists.
+	mon.send(clientUpdate("b", 2))
+	mon.send(clientUpdate("a", 3))
+	if got := describeQueue(mon.takeQueued()); fmt.Sprint(got) != "[update:b:2 update:a:3]" {
+		t.Fatalf("second batch = %v", got)
+	}
+}
+
+func TestMonitorSendOverflowDisconnects(t *testing.T) {
+	mon, peer := newTestMonitor(t)
+
+	for i := 0; i < monitorQueueSize; i++ {
+		if err := mon.send(clientUpdate(fmt.Sprintf("client-%d", i), float64(i))); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+	}
+
+	// A full queue still absorbs updates for clients already pending.
+	if err := mon.send(clientUpdate("client-0", 99)); err != nil {
+		t.Fatalf("coalesced send on a full queue: %v", err)
+	}
+
+	if err := mon.send(clientUpdate("one-too-many", 0)); !errors.Is(err, errMonitorLagging) {
+		t.Fatalf("overflow error = %v, want errMonitorLagging", err)
+	}
+	if err := mon.send(clientUpdate("client-1", 0)); !errors.Is(err, errMonitorClosed) {
+		t.Fatalf("send after overflow = %v, want errMonitorClosed", err)
+	}
+	if queued := mon.takeQueued(); len(queued) != 0 {
+		t.Fatalf("closed monitor still has %d queued messages", len(queued))
+	}
+
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := peer.Read(make([]byte, 1)); err == nil {
+		t.Fatal("monitor connection still open after overflow")
+	}
+}
+
+func TestMonitorWriteLoopDeliversInOrder(t *testing.T) {
+	mon, peer := newTestMonitor(t)
+	go mon.writeLoop()
+	defer mon.close()
+
+	mon.send(clientUpdate("a", 1))
+	mon.send(protocol.Message{Type: "client_removed", Data: protocol.ClientRemovedData{ClientID: "a"}})
+
+	reader := bufio.NewReader(peer)
+	peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for i, wantType := range []string{"client_update", "client_removed"} {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			t.Fatalf("read message %d: %v", i+1, err)
+		}
+		msg, err := protocol.Decode(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type != wantType || msg.Seq != uint64(i+1) || msg.Timestamp.IsZero() {
+			t.Fatalf("message %d = %s seq %d ts %v, want %s seq %d with a timestamp", i+1, msg.Type, msg.Seq, msg.Timestamp, wantType, i+1)
+		}
+	}
+}
+
+func TestRegisterMonitorClosesReplacedEntry(t *testing.T) {
+	first, firstPeer := net.Pipe()
+	defer firstPeer.Close()
+	second, secondPeer := net.Pipe()
+	defer secondPeer.Close()
+
+	old := registerMonitor("monitor-replaced", "", first)
+	mon := registerMonitor("monitor-replaced", "", second)
+	defer unregisterMonitor("monitor-replaced")
+
+	if err := old.send(clientUpdate("a", 1)); !errors.Is(err, errMonitorClosed) {
+		t.Fatalf("send to replaced monitor = %v, want errMonitorClosed", err)
+	}
+	firstPeer.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := firstPeer.Read(make([]byte, 1)); err == nil {
+		t.Fatal("replaced monitor connection still open")
+	}
+	if list := snapshotMonitors(); len(list) != 1 || list[0] != mon {
+		t.Fatalf("monitors = %v, want only the new registration", list)
+	}
+}
+
+func TestRepeatedHandshakeIsRejected(t *testing.T) {
+	server, peer := net.Pipe()
+	defer server.Close()
+	defer peer.Close()
+
+	ctx := &messageContext{
+		connSession: &connSession{remote: "client-rehandshake", conn: server, role: "client", done: make(chan struct{})},
+		msg:         protocol.Message{Type: "handshake", Data: &protocol.HandshakeData{Role: "monitor"}},
+		at:          time.Now(),
+	}
+	err := handleHandshake(ctx)
+
+	var reqErr *requestError
+	if !errors.As(err, &reqErr) || reqErr.code != protocol.ErrorInvalidRequest {
+		t.Fatalf("second handshake error = %v, want an invalid_request error", err)
+	}
+	if ctx.role != "client" || ctx.monitor != nil {
+		t.Fatalf("session became role %q, monitor %v", ctx.role, ctx.monitor)
+	}
+	for _, mon := range snapshotMonitors() {
+		if mon.remote == "client-rehandshake" {
+			t.Fatal("client registered as a monitor by its second handshake")
+		}
+	}
+}
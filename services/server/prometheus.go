@@ -0,0 +1,281 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"libs/protocol"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Counters exported as server self-metrics on /metrics.
+var (
+	statsMu        sync.Mutex
+	messagesByType = make(map[string]uint64)
+	parseErrors    = make(map[string]uint64)
+	serverStarted  = time.Now()
+)
+
+// countMessage records a successfully decoded message. Only known types are
+// counted, so peers cannot inflate the label set.
+func countMessage(msgType string) {
+	statsMu.Lock()
+	messagesByType[msgType]++
+	statsMu.Unlock()
+}
+
+// countParseError records a line that could not be decoded, by error code.
+func countParseError(code string) {
+	statsMu.Lock()
+	parseErrors[code]++
+	statsMu.Unlock()
+}
+
+// promFamily is one metric in the Prometheus text exposition format.
+type promFamily struct {
+	name    string
+	help    string
+	kind    string
+	samples []promSample
+}
+
+// promSample is a value with its label pairs (name, value, name, value...).
+type promSample struct {
+	labels []string
+	value  float64
+}
+
+// add appends a sample to the family.
+func (f *promFamily) add(value float64, labels ...string) {
+	f.samples = append(f.samples, promSample{labels: labels, value: value})
+}
+
+// handleHTTPMetrics serves the latest metrics of every client, labelled by
+// client_id and remote_addr, followed by the server's own counters.
+func handleHTTPMetrics(w http.ResponseWriter, r *http.Request) {
+	summaries := collectClientSummaries()
+	slices.SortFunc(summaries, func(a, b protocol.ClientStateSummary) int {
+		return strings.Compare(summaryClientID(a), summaryClientID(b))
+	})
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, family := range clientFamilies(summaries) {
+		writePromFamily(w, family)
+	}
+	for _, family := range serverFamilies() {
+		writePromFamily(w, family)
+	}
+}
+
+// clientFamilies converts the client summaries into gauges.
+func clientFamilies(summaries []protocol.ClientStateSummary) []*promFamily {
+	var (
+		cpu           = &promFamily{name: "ach_client_cpu_usage_percent", help: "Total CPU usage of the client.", kind: "gauge"}
+		cores         = &promFamily{name: "ach_client_cpu_core_usage_percent", help: "CPU usage of each core of the client.", kind: "gauge"}
+		memTotal      = &promFamily{name: "ach_client_memory_total_bytes", help: "Total memory of the client.", kind: "gauge"}
+		memUsed       = &promFamily{name: "ach_client_memory_used_bytes", help: "Memory in use on the client.", kind: "gauge"}
+		memPct        = &promFamily{name: "ach_client_memory_used_percent", help: "Memory in use on the client, in percent.", kind: "gauge"}
+		diskTotal     = &promFamily{name: "ach_client_disk_total_bytes", help: "Size of the client's root volume.", kind: "gauge"}
+		diskUsed      = &promFamily{name: "ach_client_disk_used_bytes", help: "Space in use on the client's root volume.", kind: "gauge"}
+		diskFree      = &promFamily{name: "ach_client_disk_free_bytes", help: "Free space on the client's root volume.", kind: "gauge"}
+		diskPct       = &promFamily{name: "ach_client_disk_used_percent", help: "Space in use on the client's root volume, in percent.", kind: "gauge"}
+		info          = &promFamily{name: "ach_client_info", help: "Host description of the client; the value is always 1.", kind: "gauge"}
+		bootTime      = &promFamily{name: "ach_client_boot_time_seconds", help: "When the client host booted.", kind: "gauge"}
+		load1         = &promFamily{name: "ach_client_load1", help: "1 minute load average of the client.", kind: "gauge"}
+		load5         = &promFamily{name: "ach_client_load5", help: "5 minute load average of the client.", kind: "gauge"}
+		load15        = &promFamily{name: "ach_client_load15", help: "15 minute load average of the client.", kind: "gauge"}
+		swapTotal     = &promFamily{name: "ach_client_swap_total_bytes", help: "Swap space of the client.", kind: "gauge"}
+		swapUsed      = &promFamily{name: "ach_client_swap_used_bytes", help: "Swap in use on the client.", kind: "gauge"}
+		swapPct       = &promFamily{name: "ach_client_swap_used_percent", help: "Swap in use on the client, in percent.", kind: "gauge"}
+		ctxSwitches   = &promFamily{name: "ach_client_context_switches_per_second", help: "Context switches per second on the client.", kind: "gauge"}
+		procsRunning  = &promFamily{name: "ach_client_procs_running", help: "Runnable processes on the client.", kind: "gauge"}
+		procsBlocked  = &promFamily{name: "ach_client_procs_blocked", help: "Processes blocked on I/O on the client.", kind: "gauge"}
+		fsSize        = &promFamily{name: "ach_client_filesystem_size_bytes", help: "Size of each filesystem mounted on the client.", kind: "gauge"}
+		fsUsed        = &promFamily{name: "ach_client_filesystem_used_bytes", help: "Space in use on each client filesystem.", kind: "gauge"}
+		fsFree        = &promFamily{name: "ach_client_filesystem_free_bytes", help: "Free space on each client filesystem.", kind: "gauge"}
+		fsPct         = &promFamily{name: "ach_client_filesystem_used_percent", help: "Space in use on each client filesystem, in percent.", kind: "gauge"}
+		fsInodes      = &promFamily{name: "ach_client_filesystem_inodes", help: "Inodes of each client filesystem.", kind: "gauge"}
+		fsInodesUsed  = &promFamily{name: "ach_client_filesystem_inodes_used", help: "Inodes in use on each client filesystem.", kind: "gauge"}
+		fsInodesPct   = &promFamily{name: "ach_client_filesystem_inodes_used_percent", help: "Inodes in use on each client filesystem, in percent.", kind: "gauge"}
+		ioReads       = &promFamily{name: "ach_client_disk_reads_per_second", help: "Read operations per second on each client block device.", kind: "gauge"}
+		ioWrites      = &promFamily{name: "ach_client_disk_writes_per_second", help: "Write operations per second on each client block device.", kind: "gauge"}
+		ioReadBytes   = &promFamily{name: "ach_client_disk_read_bytes_per_second", help: "Bytes read per second on each client block device.", kind: "gauge"}
+		ioWriteBytes  = &promFamily{name: "ach_client_disk_write_bytes_per_second", help: "Bytes written per second on each client block device.", kind: "gauge"}
+		ioBusy        = &promFamily{name: "ach_client_disk_busy_percent", help: "Share of time each client block device had requests in flight.", kind: "gauge"}
+		procCPU       = &promFamily{name: "ach_client_process_cpu_percent", help: "CPU usage of the client's top processes.", kind: "gauge"}
+		procMem       = &promFamily{name: "ach_client_process_memory_bytes", help: "Resident memory of the client's top processes.", kind: "gauge"}
+		procPct       = &promFamily{name: "ach_client_process_memory_percent", help: "Memory of the client's top processes, in percent of the total.", kind: "gauge"}
+		netBytesIn    = &promFamily{name: "ach_client_network_receive_bytes_per_second", help: "Bytes received per second on each client interface.", kind: "gauge"}
+		netBytesOut   = &promFamily{name: "ach_client_network_transmit_bytes_per_second", help: "Bytes sent per second on each client interface.", kind: "gauge"}
+		netPacketsIn  = &promFamily{name: "ach_client_network_receive_packets_per_second", help: "Packets received per second on each client interface.", kind: "gauge"}
+		netPacketsOut = &promFamily{name: "ach_client_network_transmit_packets_per_second", help: "Packets sent per second on each client interface.", kind: "gauge"}
+		netErrorsIn   = &promFamily{name: "ach_client_network_receive_errors_per_second", help: "Receive errors per second on each client interface.", kind: "gauge"}
+		netErrorsOut  = &promFamily{name: "ach_client_network_transmit_errors_per_second", help: "Transmit errors per second on each client interface.", kind: "gauge"}
+		netDropsIn    = &promFamily{name: "ach_client_network_receive_drops_per_second", help: "Incoming packets dropped per second on each client interface.", kind: "gauge"}
+		netDropsOut   = &promFamily{name: "ach_client_network_transmit_drops_per_second", help: "Outgoing packets dropped per second on each client interface.", kind: "gauge"}
+		updated       = &promFamily{name: "ach_client_last_update_timestamp_seconds", help: "When the client last reported data.", kind: "gauge"}
+		interval      = &promFamily{name: "ach_client_stats_interval_seconds", help: "Interval between the client's reports.", kind: "gauge"}
+		healthy       = &promFamily{name: "ach_client_healthy", help: "1 while the client reports on time, 0 when it is late or stale.", kind: "gauge"}
+	)
+
+	for _, s := range summaries {
+		id, remote := summaryClientID(s), s.RemoteAddr
+		if cur := s.CPU; cur != nil {
+			cpu.add(cur.Usage, "client_id", id, "remote_addr", remote)
+			for i, usage := range cur.CoresUsage {
+				cores.add(usage, "client_id", id, "remote_addr", remote, "core", strconv.Itoa(i))
+			}
+		}
+		if mem := s.Memory; mem != nil {
+			memTotal.add(float64(mem.Total), "client_id", id, "remote_addr", remote)
+			memUsed.add(float64(mem.Used), "client_id", id, "remote_addr", remote)
+			memPct.add(mem.UsedPercent, "client_id", id, "remote_addr", remote)
+		}
+		if disk := s.Disk; disk != nil {
+			diskTotal.add(float64(disk.Total), "client_id", id, "remote_addr", remote)
+			diskUsed.add(float64(disk.Used), "client_id", id, "remote_addr", remote)
+			diskFree.add(float64(disk.Free), "client_id", id, "remote_addr", remote)
+			diskPct.add(disk.UsedPercent, "client_id", id, "remote_addr", remote)
+		}
+		if general := s.General; general != nil && general.Hostname != "" {
+			info.add(1, "client_id", id, "remote_addr", remote, "hostname", general.Hostname, "os", general.OS,
+				"platform", general.Platform, "platform_version", general.PlatformVersion,
+				"kernel_version", general.KernelVersion, "kernel_arch", general.KernelArch)
+			if !general.BootTime.IsZero() {
+				bootTime.add(float64(general.BootTime.Unix()), "client_id", id, "remote_addr", remote)
+			}
+		}
+		if load := s.Load; load != nil {
+			load1.add(load.Load1, "client_id", id, "remote_addr", remote)
+			load5.add(load.Load5, "client_id", id, "remote_addr", remote)
+			load15.add(load.Load15, "client_id", id, "remote_addr", remote)
+			swapTotal.add(float64(load.SwapTotal), "client_id", id, "remote_addr", remote)
+			swapUsed.add(float64(load.SwapUsed), "client_id", id, "remote_addr", remote)
+			swapPct.add(load.SwapUsedPercent, "client_id", id, "remote_addr", remote)
+			ctxSwitches.add(load.ContextSwitchesPerSec, "client_id", id, "remote_addr", remote)
+			procsRunning.add(float64(load.ProcsRunning), "client_id", id, "remote_addr", remote)
+			procsBlocked.add(float64(load.ProcsBlocked), "client_id", id, "remote_addr", remote)
+		}
+		if disk := s.Disk; disk != nil {
+			for _, m := range disk.Mounts {
+				labels := []string{"client_id", id, "remote_addr", remote, "mountpoint", m.Mountpoint, "device", m.Device, "fstype", m.Fstype}
+				fsSize.add(float64(m.Total), labels...)
+				fsUsed.add(float64(m.Used), labels...)
+				fsFree.add(float64(m.Free), labels...)
+				fsPct.add(m.UsedPercent, labels...)
+				fsInodes.add(float64(m.InodesTotal), labels...)
+				fsInodesUsed.add(float64(m.InodesUsed), labels...)
+				fsInodesPct.add(m.InodesUsedPercent, labels...)
+			}
+		}
+		if io := s.DiskIO; io != nil {
+			for _, d := range io.Devices {
+				labels := []string{"client_id", id, "remote_addr", remote, "device", d.Name}
+				ioReads.add(d.ReadsPerSec, labels...)
+				ioWrites.add(d.WritesPerSec, labels...)
+				ioReadBytes.add(d.ReadBytesPerSec, labels...)
+				ioWriteBytes.add(d.WriteBytesPerSec, labels...)
+				ioBusy.add(d.BusyPercent, labels...)
+			}
+		}
+		if procs := s.Processes; procs != nil {
+			for _, p := range procs.Processes {
+				pid := strconv.Itoa(int(p.PID))
+				procCPU.add(p.CPUPercent, "client_id", id, "remote_addr", remote, "pid", pid, "name", p.Name)
+				procMem.add(p.MemoryMB*1024*1024, "client_id", id, "remote_addr", remote, "pid", pid, "name", p.Name)
+				procPct.add(float64(p.MemoryPercent), "client_id", id, "remote_addr", remote, "pid", pid, "name", p.Name)
+			}
+		}
+		if network := s.Network; network != nil {
+			for _, iface := range network.Interfaces {
+				labels := []string{"client_id", id, "remote_addr", remote, "interface", iface.Name}
+				netBytesIn.add(iface.BytesInPerSec, labels...)
+				netBytesOut.add(iface.BytesOutPerSec, labels...)
+				netPacketsIn.add(iface.PacketsInPerSec, labels...)
+				netPacketsOut.add(iface.PacketsOutPerSec, labels...)
+				netErrorsIn.add(iface.ErrorsInPerSec, labels...)
+				netErrorsOut.add(iface.ErrorsOutPerSec, labels...)
+				netDropsIn.add(iface.DropsInPerSec, labels...)
+				netDropsOut.add(iface.DropsOutPerSec, labels...)
+			}
+		}
+		if !s.LastUpdate.IsZero() {
+			updated.add(float64(s.LastUpdate.UnixMilli())/1000, "client_id", id, "remote_addr", remote)
+		}
+		if s.StatsIntervalMs > 0 {
+			interval.add(float64(s.StatsIntervalMs)/1000, "client_id", id, "remote_addr", remote)
+		}
+		up := 0.0
+		if s.Health == protocol.HealthHealthy {
+			up = 1
+		}
+		healthy.add(up, "client_id", id, "remote_addr", remote)
+	}
+
+	return []*promFamily{cpu, cores, memTotal, memUsed, memPct, diskTotal, diskUsed, diskFree, diskPct,
+		info, bootTime, load1, load5, load15, swapTotal, swapUsed, swapPct, ctxSwitches, procsRunning, procsBlocked,
+		fsSize, fsUsed, fsFree, fsPct, fsInodes, fsInodesUsed, fsInodesPct,
+		ioReads, ioWrites, ioReadBytes, ioWriteBytes, ioBusy,
+		procCPU, procMem, procPct,
+		netBytesIn, netBytesOut, netPacketsIn, netPacketsOut, netErrorsIn, netErrorsOut, netDropsIn, netDropsOut,
+		updated, interval, healthy}
+}
+
+// serverFamilies reports the server's own state and counters.
+func serverFamilies() []*promFamily {
+	clients := &promFamily{name: "ach_server_connected_clients", help: "Clients connected to the server.", kind: "gauge"}
+	clients.add(float64(len(snapshotClientConns())))
+	monitors := &promFamily{name: "ach_server_connected_monitors", help: "Monitors connected to the server.", kind: "gauge"}
+	monitors.add(float64(len(snapshotMonitors())))
+	started := &promFamily{name: "ach_server_start_time_seconds", help: "When the server started.", kind: "gauge"}
+	started.add(float64(serverStarted.UnixMilli()) / 1000)
+
+	messages := &promFamily{name: "ach_server_messages_received_total", help: "Messages received from clients and monitors, by type.", kind: "counter"}
+	failures := &promFamily{name: "ach_server_parse_errors_total", help: "Received lines that could not be decoded, by error code.", kind: "counter"}
+
+	statsMu.Lock()
+	for _, msgType := range slices.Sorted(maps.Keys(messagesByType)) {
+		messages.add(float64(messagesByType[msgType]), "type", msgType)
+	}
+	for _, code := range slices.Sorted(maps.Keys(parseErrors)) {
+		failures.add(float64(parseErrors[code]), "code", code)
+	}
+	statsMu.Unlock()
+
+	return []*promFamily{clients, monitors, started, messages, failures}
+}
+
+// writePromFamily prints a family with its HELP and TYPE lines. Families
+// without samples are skipped.
+func writePromFamily(w io.Writer, f *promFamily) {
+	if len(f.samples) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+	for _, s := range f.samples {
+		var labels strings.Builder
+		for i := 0; i+1 < len(s.labels); i += 2 {
+			if labels.Len() > 0 {
+				labels.WriteByte(',')
+			}
+			fmt.Fprintf(&labels, "%s=\"%s\"", s.labels[i], escapeLabelValue(s.labels[i+1]))
+		}
+		if labels.Len() > 0 {
+			fmt.Fprintf(w, "%s{%s} %s\n", f.name, labels.String(), strconv.FormatFloat(s.value, 'g', -1, 64))
+		} else {
+			fmt.Fprintf(w, "%s %s\n", f.name, strconv.FormatFloat(s.value, 'g', -1, 64))
+		}
+	}
+}
+
+// escapeLabelValue escapes backslashes, quotes and newlines as required by the
+// exposition format.
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"libs/protocol"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// registerTestClient stores a client state the way a handshake and a few
+// metric messages would, removing it when the test ends.
+func registerTestClient(t *testing.T, remote, clientID string, update func(state *ClientState)) *ClientState {
+	t.Helper()
+	t.Cleanup(func() { removeClientState(remote) })
+	return updateClientState(remote, time.Unix(1714564800, 500e6), func(state *ClientState) {
+		state.Handshake = &protocol.HandshakeData{Role: "client", ClientID: clientID}
+		state.Interval = 2 * time.Second
+		update(state)
+	})
+}
+
+func TestClientFamiliesExposition(t *testing.T) {
+	state := registerTestClient(t, "10.0.0.7:5000", "agent-1", func(state *ClientState) {
+		state.CPU = &protocol.CpuUsageData{Usage: 12.5, CoresUsage: []float64{10, 15}}
+		state.General = &protocol.GeneralData{
+			Hostname:        `web"01`,
+			OS:              "linux",
+			Platform:        `C:\distro`,
+			PlatformVersion: "24.04\nLTS",
+			KernelVersion:   "6.8.0",
+			KernelArch:      "x86_64",
+		}
+	})
+
+	var out strings.Builder
+	for _, family := range clientFamilies([]protocol.ClientStateSummary{makeClientSummary(state)}) {
+		writePromFamily(&out, family)
+	}
+
+	want := `# HELP ach_client_cpu_usage_percent Total CPU usage of the client.
+# TYPE ach_client_cpu_usage_percent gauge
+ach_client_cpu_usage_percent{client_id="agent-1",remote_addr="10.0.0.7:5000"} 12.5
+# HELP ach_client_cpu_core_usage_percent CPU usage of each core of the client.
+# TYPE ach_client_cpu_core_usage_percent gauge
+ach_client_cpu_core_usage_percent{client_id="agent-1",remote_addr="10.0.0.7:5000",core="0"} 10
+ach_client_cpu_core_usage_percent{client_id="agent-1",remote_addr="10.0.0.7:5000",core="1"} 15
+# HELP ach_client_info Host description of the client; the value is always 1.
+# TYPE ach_client_info gauge
+ach_client_info{client_id="agent-1",remote_addr="10.0.0.7:5000",hostname="web\"01",os="linux",platform="C:\\distro",platform_version="24.04\nLTS",kernel_version="6.8.0",kernel_arch="x86_64"} 1
+# HELP ach_client_last_update_timestamp_seconds When the client last reported data.
+# TYPE ach_client_last_update_timestamp_seconds gauge
+ach_client_last_update_timestamp_seconds{client_id="agent-1",remote_addr="10.0.0.7:5000"} 1.7145648005e+09
+# HELP ach_client_stats_interval_seconds Interval between the client's reports.
+# TYPE ach_client_stats_interval_seconds gauge
+ach_client_stats_interval_seconds{client_id="agent-1",remote_addr="10.0.0.7:5000"} 2
+# HELP ach_client_healthy 1 while the client reports on time, 0 when it is late or stale.
+# TYPE ach_client_healthy gauge
+ach_client_healthy{client_id="agent-1",remote_addr="10.0.0.7:5000"} 1
+`
+	if got := out.String(); got != want {
+		t.Fatalf("exposition mismatch\n got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHandleHTTPMetricsOrdersClientsAndFamilies(t *testing.T) {
+	for _, c := range []struct{ remote, id string }{{"10.0.0.2:1", "zeta"}, {"10.0.0.1:1", "alpha"}} {
+		registerTestClient(t, c.remote, c.id, func(state *ClientState) {
+			state.CPU = &protocol.CpuUsageData{Usage: 1}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	handleHTTPMetrics(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	// Clients are sorted by ID within a family, client families come before
+	// the server's own, and each family is introduced once.
+	order := []string{
+		`ach_client_cpu_usage_percent{client_id="alpha"`,
+		`ach_client_cpu_usage_percent{client_id="zeta"`,
+		`ach_client_healthy{client_id="alpha"`,
+		"# HELP ach_server_connected_clients ",
+		"# TYPE ach_server_start_time_seconds gauge\n",
+	}
+	last := -1
+	for _, line := range order {
+		i := strings.Index(body, line)
+		if i < 0 {
+			t.Fatalf("missing %q in:\n%s", line, body)
+		}
+		if i < last {
+			t.Fatalf("%q out of order in:\n%s", line, body)
+		}
+		last = i
+	}
+	if n := strings.Count(body, "# TYPE ach_client_cpu_usage_percent "); n != 1 {
+		t.Fatalf("cpu family introduced %d times", n)
+	}
+}
+
+func TestEscapeLabelValue(t *testing.T) {
+	tests := map[string]string{
+		"plain":        "plain",
+		`say "hi"`:     `say \"hi\"`,
+		`C:\path`:      `C:\\path`,
+		"two\nlines":   `two\nlines`,
+		`\"` + "\n":    `\\\"\n`,
+		"unicode ação": "unicode ação",
+	}
+	for in, want := range tests {
+		if got := escapeLabelValue(in); got != want {
+			t.Errorf("escapeLabelValue(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"libs/protocol"
+	"net"
+	"slices"
+	"time"
+)
+
+// messageSender is implemented by the registered connections (ClientConn and
+// MonitorConn), which stamp and serialize their writes.
+type messageSender interface {
+	send(msg protocol.Message) error
+}
+
+// connSession is the per-connection state shared by the message handlers.
+type connSession struct {
+	remote  string
+	conn    net.Conn
+	role    string
+	access  string
+	monitor *MonitorConn
+	peer    messageSender
+	seqs    sequenceTracker
+	// heartbeat is set once the peer agreed to answer pings; done stops the
+	// ping loop when the connection ends.
+	heartbeat bool
+	done      chan struct{}
+}
+
+// messageContext is what a handler receives: the connection it came from, the
+// decoded message and the time it was produced.
+type messageContext struct {
+	*connSession
+	msg protocol.Message
+	at  time.Time
+}
+
+// messageHandler declares how the server deals with one message type.
+type messageHandler struct {
+	// Type is the protocol message type, e.g. "cpu_usage".
+	Type string
+	// NewPayload returns a pointer to an empty payload. When set it is
+	// registered with protocol.Register so Decode yields the typed struct.
+	NewPayload func() interface{}
+	// Roles lists the peers allowed to send the message after the handshake.
+	// An empty list means the message is accepted before the handshake too.
+	Roles []string
+	// Access is the access level required from monitors, e.g. accessAdmin
+	// for messages that change client settings. Empty means any level.
+	Access string
+	// Handle processes the decoded message; ctx.msg.Data holds the payload.
+	// A *requestError is reported to the sender with its code.
+	Handle func(ctx *messageContext) error
+}
+
+var messageHandlers = make(map[string]messageHandler)
+
+// errDisconnect is wrapped by handler errors that must end the connection,
+// such as a peer failing authentication.
+var errDisconnect = errors.New("closing connection")
+
+// requestError is a handler failure caused by the request itself, reported
+// back to the sender in an error message with one of the protocol codes.
+type requestError struct {
+	code    string
+	message string
+}
+
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// newRequestError builds a requestError with a formatted message.
+func newRequestError(code, format string, args ...interface{}) error {
+	return &requestError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// registerHandler adds a message type to the server. It is meant to be called
+// from init functions, so the registry is read-only once connections arrive.
+func registerHandler(h messageHandler) {
+	if h.Type == "" || h.Handle == nil {
+		panic("registerHandler: type and handler are required")
+	}
+	if _, exists := messageHandlers[h.Type]; exists {
+		panic(fmt.Sprintf("registerHandler: %s registered twice", h.Type))
+	}
+	if h.NewPayload != nil {
+		protocol.Register(h.Type, h.NewPayload)
+	}
+	messageHandlers[h.Type] = h
+}
+
+// dispatchMessage checks that the peer may send the message and runs its
+// handler. It returns false when the connection must be closed.
+func dispatchMessage(ctx *messageContext) bool {
+	h, ok := messageHandlers[ctx.msg.Type]
+	if !ok {
+		fmt.Printf("❓ Unknown message type from %s: %s\n", ctx.remote, ctx.msg.Type)
+		ctx.sendError(ctx.msg, protocol.ErrorUnknownType, fmt.Sprintf("unknown message type %q", ctx.msg.Type))
+		return true
+	}
+
+	if len(h.Roles) > 0 {
+		if ctx.role == "" {
+			fmt.Printf("⚠️  Ignoring %s from %s: handshake not completed\n", ctx.msg.Type, ctx.remote)
+			ctx.sendError(ctx.msg, protocol.ErrorHandshakeRequired, "handshake not completed")
+			// With authentication on, unauthenticated peers are not kept around.
+			return len(authCredentials) == 0
+		}
+		if !slices.Contains(h.Roles, ctx.role) {
+			fmt.Printf("🚫 Ignoring %s from %s: role %s not allowed\n", ctx.msg.Type, ctx.remote, ctx.role)
+			ctx.sendError(ctx.msg, protocol.ErrorForbidden, fmt.Sprintf("%s not allowed for role %s", ctx.msg.Type, ctx.role))
+			return true
+		}
+		if h.Access == accessAdmin && ctx.access != accessAdmin {
+			fmt.Printf("🚫 Ignoring %s from %s: admin access required\n", ctx.msg.Type, ctx.remote)
+			ctx.sendError(ctx.msg, protocol.ErrorForbidden, fmt.Sprintf("%s requires admin access", ctx.msg.Type))
+			return true
+		}
+		if cc, ok := ctx.peer.(*ClientConn); ok && cc.replaced.Load() {
+			// The kick closes the connection shortly; until then nothing it
+			// sends may be stored under the ID its replacement now owns.
+			fmt.Printf("🥾 Ignoring %s from %s: client_id %s taken over\n", ctx.msg.Type, ctx.remote, cc.clientID)
+			return true
+		}
+		if ctx.role == "client" {
+			if state, ok := getClientState(ctx.remote); !ok || state.Handshake == nil {
+				fmt.Printf("⚠️  Ignoring %s from %s: client state unavailable\n", ctx.msg.Type, ctx.remote)
+				ctx.sendError(ctx.msg, protocol.ErrorInternal, "client state unavailable")
+				return true
+			}
+		}
+	}
+
+	err := h.Handle(ctx)
+	if err == nil {
+		return true
+	}
+
+	fmt.Printf("❌ Error handling %s from %s: %v\n", ctx.msg.Type, ctx.remote, err)
+	if errors.Is(err, errDisconnect) {
+		return false
+	}
+
+	var reqErr *requestError
+	if errors.As(err, &reqErr) {
+		ctx.sendError(ctx.msg, reqErr.code, reqErr.message)
+	} else {
+		ctx.sendError(ctx.msg, protocol.ErrorInternal, err.Error())
+	}
+	return true
+}
+
+// sendError reports a problem with a received message back to its sender,
+// referencing the offending message by type and ID.
+func (s *connSession) sendError(ref protocol.Message, code, message string) {
+	msg := protocol.Message{
+		Type: "error",
+		Data: protocol.ErrorData{
+			Code:    code,
+			Message: message,
+			RefID:   ref.ID,
+			RefType: ref.Type,
+		},
+	}
+
+	if err := s.send(msg); err != nil {
+		fmt.Printf("❌ Error sending error reply to %s: %v\n", s.remote, err)
+	}
+}
+
+// send writes through the registered connection once the handshake is done.
+// Before that nothing else writes to the socket, so the message goes straight
+// to it.
+func (s *connSession) send(msg protocol.Message) error {
+	if s.peer != nil {
+		return s.peer.send(msg)
+	}
+
+	payload, err := protocol.Encode(msg)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn.Write(payload)
+	return err
+}
@@ -0,0 +1,35 @@
+package main
+
+import "libs/protocol"
+
+// sequenceTracker follows the sequence numbers of a single connection to
+// detect messages lost or delivered twice by the producer.
+type sequenceTracker struct {
+	counters protocol.SequenceStats
+}
+
+// observe records a sequence number, returning how many messages are missing
+// before it and whether it was already seen. Unnumbered messages (seq 0) come
+// from peers that do not stamp the envelope and are ignored.
+func (t *sequenceTracker) observe(seq uint64) (missing uint64, duplicate bool) {
+	if seq == 0 {
+		return 0, false
+	}
+
+	t.counters.Received++
+	switch {
+	case seq <= t.counters.LastSeq:
+		t.counters.Duplicates++
+		return 0, true
+	case seq > t.counters.LastSeq+1:
+		missing = seq - t.counters.LastSeq - 1
+		t.counters.Missing += missing
+	}
+	t.counters.LastSeq = seq
+	return missing, false
+}
+
+// stats returns a copy of the counters collected so far.
+func (t *sequenceTracker) stats() protocol.SequenceStats {
+	return t.counters
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"libs/protocol"
+	"testing"
+)
+
+func TestSequenceTracker(t *testing.T) {
+	tests := []struct {
+		name       string
+		seqs       []uint64
+		wantStats  protocol.SequenceStats
+		wantGaps   []uint64
+		wantDupsAt []int
+	}{
+		{
+			name:      "contiguous",
+			seqs:      []uint64{1, 2, 3},
+			wantStats: protocol.SequenceStats{LastSeq: 3, Received: 3},
+			wantGaps:  []uint64{0, 0, 0},
+		},
+		{
+			name:      "gap",
+			seqs:      []uint64{1, 2, 5, 6, 9},
+			wantStats: protocol.SequenceStats{LastSeq: 9, Received: 5, Missing: 4},
+			wantGaps:  []uint64{0, 0, 2, 0, 2},
+		},
+		{
+			name:      "first message lost",
+			seqs:      []uint64{3, 4},
+			wantStats: protocol.SequenceStats{LastSeq: 4, Received: 2, Missing: 2},
+			wantGaps:  []uint64{2, 0},
+		},
+		{
+			name:       "duplicate",
+			seqs:       []uint64{1, 2, 2, 3},
+			wantStats:  protocol.SequenceStats{LastSeq: 3, Received: 4, Duplicates: 1},
+			wantGaps:   []uint64{0, 0, 0, 0},
+			wantDupsAt: []int{2},
+		},
+		{
+			// Over one TCP connection an older number can only be a replay;
+			// it never moves the last sequence backwards.
+			name:       "older number after a gap",
+			seqs:       []uint64{1, 3, 2, 4},
+			wantStats:  protocol.SequenceStats{LastSeq: 4, Received: 4, Missing: 1, Duplicates: 1},
+			wantGaps:   []uint64{0, 1, 0, 0},
+			wantDupsAt: []int{2},
+		},
+		{
+			name:      "unnumbered messages are ignored",
+			seqs:      []uint64{0, 1, 0, 2},
+			wantStats: protocol.SequenceStats{LastSeq: 2, Received: 2},
+			wantGaps:  []uint64{0, 0, 0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tracker sequenceTracker
+			dups := map[int]bool{}
+			for _, i := range tt.wantDupsAt {
+				dups[i] = true
+			}
+			for i, seq := range tt.seqs {
+				gap, dup := tracker.observe(seq)
+				if gap != tt.wantGaps[i] || dup != dups[i] {
+					t.Fatalf("observe(%d) at #%d = missing %d, duplicate %t; want %d, %t", seq, i, gap, dup, tt.wantGaps[i], dups[i])
+				}
+			}
+			if got := tracker.stats(); got != tt.wantStats {
+				t.Fatalf("stats = %+v, want %+v", got, tt.wantStats)
+			}
+		})
+	}
+}
+
+func TestSequenceRestartsWithTheConnection(t *testing.T) {
+	// The agent numbers each connection from 1, so after a reconnect the new
+	// session must not take the restart for duplicates of the old one.
+	old := &connSession{remote: "10.0.0.1:1000"}
+	for _, seq := range []uint64{1, 2, 3, 5} {
+		old.seqs.observe(seq)
+	}
+
+	reconnected := &connSession{remote: "10.0.0.1:1001"}
+	for _, seq := range []uint64{1, 2} {
+		if gap, dup := reconnected.seqs.observe(seq); gap != 0 || dup {
+			t.Fatalf("seq %d after reconnect = missing %d, duplicate %t", seq, gap, dup)
+		}
+	}
+
+	if got, want := old.seqs.stats(), (protocol.SequenceStats{LastSeq: 5, Received: 4, Missing: 1}); got != want {
+		t.Fatalf("old connection stats = %+v, want %+v", got, want)
+	}
+	if got, want := reconnected.seqs.stats(), (protocol.SequenceStats{LastSeq: 2, Received: 2}); got != want {
+		t.Fatalf("new connection stats = %+v, want %+v", got, want)
+	}
+
+	// Reusing a tracker across connections would count the restart as
+	// duplicates, which is why each session owns one.
+	if _, dup := old.seqs.observe(1); !dup {
+		t.Fatal("seq 1 on a used tracker not reported as duplicate")
+	}
+}
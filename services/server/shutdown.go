@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"libs/protocol"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// forcedCloseGrace is how long the connection handlers get to clean up after
+// their sockets were closed at the end of the shutdown timeout.
+const forcedCloseGrace = time.Second
+
+var (
+	activeMu    sync.Mutex
+	activeConns = make(map[net.Conn]struct{})
+	connWG      sync.WaitGroup
+
+	// shuttingDown is set once the server starts draining. Peers leaving
+	// after that are not reported to monitors as disconnected clients.
+	shuttingDown atomic.Bool
+)
+
+// trackConnection counts a new connection for waitConnections. It refuses
+// once the server is shutting down, so connWG.Add never races with the
+// connWG.Wait in waitConnections; the caller must then drop the connection.
+func trackConnection() bool {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+
+	if shuttingDown.Load() {
+		return false
+	}
+	connWG.Add(1)
+	return true
+}
+
+// serveConnection runs handleConnection while keeping track of the socket, so
+// shutdown can wait for it or close it.
+func serveConnection(conn net.Conn) {
+	activeMu.Lock()
+	activeConns[conn] = struct{}{}
+	activeMu.Unlock()
+
+	defer func() {
+		activeMu.Lock()
+		delete(activeConns, conn)
+		activeMu.Unlock()
+		connWG.Done()
+	}()
+
+	handleConnection(conn)
+}
+
+// shutdown drains the server after the listener was closed: it stops the HTTP
+// API, tells every peer the server is going away, waits for them to disconnect
+// until timeout expires, closes whatever is left and flushes the history store.
+// The whole drain shares the one timeout.
+func shutdown(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	activeMu.Lock()
+	shuttingDown.Store(true)
+	activeMu.Unlock()
+
+	stopHTTPServer(time.Until(deadline))
+	notifyShutdown("server shutting down", deadline)
+
+	if !waitConnections(time.Until(deadline)) {
+		fmt.Printf("⏳ Closing %d connection(s) still open after %s\n", closeConnections(), timeout)
+		waitConnections(forcedCloseGrace)
+	}
+
+	if historyDB != nil {
+		if err := historyDB.close(); err != nil {
+			fmt.Println("❌ Error closing history store:", err)
+		} else {
+			fmt.Println("🗄️  History store flushed")
+		}
+	}
+	fmt.Println("👋 Server stopped")
+}
+
+// notifyShutdown sends server_shutdown to every client and monitor that
+// completed the handshake. Peers are expected to disconnect on their own.
+// Clients are notified concurrently and the wait ends at deadline, so an agent
+// that stopped reading cannot hold the shutdown back; closeConnections takes
+// care of it afterwards.
+func notifyShutdown(reason string, deadline time.Time) {
+	msg := protocol.Message{
+		Type: "server_shutdown",
+		Data: protocol.ServerShutdownData{Reason: reason},
+	}
+
+	clients := snapshotClientConns()
+	var wg sync.WaitGroup
+	for _, cc := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := cc.send(msg); err != nil {
+				fmt.Printf("❌ Error notifying %s: %v\n", cc.remote, err)
+			}
+		}()
+	}
+	sent := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(time.Until(deadline)):
+		fmt.Println("⏳ Some clients did not take the shutdown notice in time")
+	}
+
+	mons := snapshotMonitors()
+	for _, mon := range mons {
+		if err := mon.send(msg); err != nil {
+			fmt.Printf("❌ Error notifying monitor %s: %v\n", mon.remote, err)
+		}
+	}
+	fmt.Printf("📣 Notified %d client(s) and %d monitor(s) of the shutdown\n", len(clients), len(mons))
+}
+
+// waitConnections waits for the connection handlers to return, reporting
+// whether they all did within timeout.
+func waitConnections(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		connWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// closeConnections closes every tracked socket and returns how many there were.
+func closeConnections() int {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+
+	for conn := range activeConns {
+		conn.Close()
+	}
+	return len(activeConns)
+}
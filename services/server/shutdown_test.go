@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNotifyShutdownDoesNotWaitForStuckClients(t *testing.T) {
+	// Nobody reads the other end of the pipe, so every write blocks.
+	server, peer := net.Pipe()
+	defer peer.Close()
+	defer server.Close()
+
+	if _, _, err := registerClientConn("stuck-peer", server, "stuck"); err != nil {
+		t.Fatal(err)
+	}
+	defer unregisterClientConn("stuck-peer")
+
+	start := time.Now()
+	notifyShutdown("test", start.Add(200*time.Millisecond))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("notifyShutdown took %s with a client that never reads", elapsed)
+	}
+}
+
+func TestTrackConnectionRefusedWhileShuttingDown(t *testing.T) {
+	defer shuttingDown.Store(false)
+
+	if !trackConnection() {
+		t.Fatal("connection refused before shutdown")
+	}
+	connWG.Done()
+
+	shuttingDown.Store(true)
+	if trackConnection() {
+		connWG.Done()
+		t.Fatal("connection tracked during shutdown")
+	}
+	if !waitConnections(time.Second) {
+		t.Fatal("refused connection left the wait group incremented")
+	}
+}
@@ -14,10 +14,17 @@ type ClientState struct {
 	CPU        *protocol.CpuUsageData
 	Memory     *protocol.MemoryUsageData
 	Disk       *protocol.DiskUsageData
+	DiskIO     *protocol.DiskIOData
 	General    *protocol.GeneralData
+	Load       *protocol.SystemLoadData
 	Processes  *protocol.ProcessUsageData
+	Network    *protocol.NetworkUsageData
 	LastUpdate time.Time
+	// ReceivedAt is when the server last received data from the agent, by the
+	// server clock; health is based on it so agent clock skew does not count.
+	ReceivedAt time.Time
 	Interval   time.Duration
+	Sequence   *protocol.SequenceStats
 }
 
 var (
@@ -27,8 +34,10 @@ var (
 )
 
 // updateClientState applies the provided mutation while holding the state
-// mutex, ensuring the caller receives the updated instance.
-func updateClientState(remote string, update func(state *ClientState)) *ClientState {
+// mutex, ensuring the caller receives the updated instance. at is the time the
+// producer generated the data and becomes the state's LastUpdate, unless the
+// state already holds newer data; ReceivedAt always moves to now.
+func updateClientState(remote string, at time.Time, update func(state *ClientState)) *ClientState {
 	stateMu.Lock()
 	defer stateMu.Unlock()
 
@@ -39,10 +48,24 @@ func updateClientState(remote string, update func(state *ClientState)) *ClientSt
 	}
 
 	update(state)
-	state.LastUpdate = time.Now()
+	state.ReceivedAt = time.Now()
+	if at.After(state.LastUpdate) {
+		state.LastUpdate = at
+	}
 	return state
 }
 
+// setClientSequence stores the sequence counters of a client connection
+// without touching LastUpdate.
+func setClientSequence(remote string, stats protocol.SequenceStats) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+
+	if state, ok := clientStates[remote]; ok {
+		state.Sequence = &stats
+	}
+}
+
 // getClientState returns the cached state for the given remote endpoint.
 func getClientState(remote string) (*ClientState, bool) {
 	stateMu.Lock()
@@ -71,7 +94,7 @@ func removeClientState(remote string) *ClientState {
 		return nil
 	}
 
-	if st.Handshake != nil {
+	if st.Handshake != nil && clientIDIndex[st.Handshake.ClientID] == remote {
 		delete(clientIDIndex, st.Handshake.ClientID)
 	}
 
@@ -116,19 +139,34 @@ func makeClientSummaryUnlocked(state *ClientState) protocol.ClientStateSummary {
 		CPU:             cloneCpuUsage(state.CPU),
 		Memory:          cloneMemoryUsage(state.Memory),
 		Disk:            cloneDiskUsage(state.Disk),
+		DiskIO:          cloneDiskIO(state.DiskIO),
 		General:         cloneGeneralData(state.General),
+		Load:            cloneSystemLoad(state.Load),
 		Processes:       cloneProcessUsage(state.Processes),
+		Network:         cloneNetworkUsage(state.Network),
 		LastUpdate:      state.LastUpdate,
 		StatsIntervalMs: state.Interval.Milliseconds(),
+		Sequence:        cloneSequenceStats(state.Sequence),
+		Health:          clientHealth(state, time.Now()),
+	}
+}
+
+// cloneSequenceStats duplicates the sequence counters.
+func cloneSequenceStats(stats *protocol.SequenceStats) *protocol.SequenceStats {
+	if stats == nil {
+		return nil
 	}
+	copy := *stats
+	return &copy
 }
 
-// cloneHandshake performs a shallow copy of the handshake data.
+// cloneHandshake duplicates the handshake data, including the feature list.
 func cloneHandshake(hs *protocol.HandshakeData) *protocol.HandshakeData {
 	if hs == nil {
 		return nil
 	}
 	copy := *hs
+	copy.Features = append([]string(nil), hs.Features...)
 	return &copy
 }
 
@@ -151,15 +189,26 @@ func cloneMemoryUsage(mem *protocol.MemoryUsageData) *protocol.MemoryUsageData {
 	return &copy
 }
 
-// cloneDiskUsage duplicates the disk usage payload.
+// cloneDiskUsage duplicates the disk usage payload, including the mounts.
 func cloneDiskUsage(disk *protocol.DiskUsageData) *protocol.DiskUsageData {
 	if disk == nil {
 		return nil
 	}
 	copy := *disk
+	copy.Mounts = append([]protocol.MountUsage(nil), disk.Mounts...)
 	return &copy
 }
 
+// cloneDiskIO duplicates the disk I/O payload and its device list.
+func cloneDiskIO(io *protocol.DiskIOData) *protocol.DiskIOData {
+	if io == nil {
+		return nil
+	}
+	clone := *io
+	clone.Devices = append([]protocol.DiskDeviceIO(nil), io.Devices...)
+	return &clone
+}
+
 // cloneGeneralData duplicates the general hardware information payload.
 func cloneGeneralData(general *protocol.GeneralData) *protocol.GeneralData {
 	if general == nil {
@@ -169,6 +218,15 @@ func cloneGeneralData(general *protocol.GeneralData) *protocol.GeneralData {
 	return &copy
 }
 
+// cloneSystemLoad duplicates the system load payload.
+func cloneSystemLoad(load *protocol.SystemLoadData) *protocol.SystemLoadData {
+	if load == nil {
+		return nil
+	}
+	copy := *load
+	return &copy
+}
+
 // cloneProcessUsage duplicates the top processes payload to avoid sharing the
 // slice between goroutines.
 func cloneProcessUsage(proc *protocol.ProcessUsageData) *protocol.ProcessUsageData {
@@ -180,6 +238,17 @@ func cloneProcessUsage(proc *protocol.ProcessUsageData) *protocol.ProcessUsageDa
 	return &clone
 }
 
+// cloneNetworkUsage duplicates the network usage payload, including the
+// interface list.
+func cloneNetworkUsage(network *protocol.NetworkUsageData) *protocol.NetworkUsageData {
+	if network == nil {
+		return nil
+	}
+	clone := *network
+	clone.Interfaces = append([]protocol.NetworkInterfaceUsage(nil), network.Interfaces...)
+	return &clone
+}
+
 // debugState prints a compact snapshot of the stored state useful while
 // developing or troubleshooting the agents.
 func debugState(remote string, state *ClientState) {
@@ -189,6 +258,13 @@ func debugState(remote string, state *ClientState) {
 	}
 	if state.General != nil {
 		fmt.Printf("   - General: %s, %d cores @ %.2f MHz\n", state.General.ModelName, state.General.Cores, state.General.Mhz)
+		if state.General.Hostname != "" {
+			fmt.Printf("   - Host: %s (%s %s, kernel %s), up since %s\n", state.General.Hostname, state.General.Platform,
+				state.General.PlatformVersion, state.General.KernelVersion, state.General.BootTime.Format(time.RFC3339))
+		}
+	}
+	if state.Load != nil {
+		fmt.Printf("   - Load: %.2f %.2f %.2f, swap %.2f%% used\n", state.Load.Load1, state.Load.Load5, state.Load.Load15, state.Load.SwapUsedPercent)
 	}
 	if state.CPU != nil {
 		fmt.Printf("   - CPU: %.2f%% total (%d cores)\n", state.CPU.Usage, len(state.CPU.CoresUsage))
@@ -198,6 +274,22 @@ func debugState(remote string, state *ClientState) {
 	}
 	if state.Disk != nil {
 		fmt.Printf("   - Disk: %.2f%% used (%d/%d)\n", state.Disk.UsedPercent, state.Disk.Used, state.Disk.Total)
+		for _, m := range state.Disk.Mounts {
+			fmt.Printf("   - Mount %s (%s): %.2f%% used, %.2f%% inodes\n", m.Mountpoint, m.Fstype, m.UsedPercent, m.InodesUsedPercent)
+		}
+	}
+	if state.DiskIO != nil {
+		for _, d := range state.DiskIO.Devices {
+			fmt.Printf("   - IO %s: read %.0f B/s, write %.0f B/s, busy %.1f%%\n", d.Name, d.ReadBytesPerSec, d.WriteBytesPerSec, d.BusyPercent)
+		}
+	}
+	if state.Network != nil {
+		for _, iface := range state.Network.Interfaces {
+			fmt.Printf("   - Net %s: in %.0f B/s, out %.0f B/s\n", iface.Name, iface.BytesInPerSec, iface.BytesOutPerSec)
+		}
+	}
+	if state.Sequence != nil {
+		fmt.Printf("   - Sequence: last=%d received=%d missing=%d duplicates=%d\n", state.Sequence.LastSeq, state.Sequence.Received, state.Sequence.Missing, state.Sequence.Duplicates)
 	}
 	if state.Processes != nil {
 		top := len(state.Processes.Processes)
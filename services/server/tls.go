@@ -0,0 +1,37 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"slices"
+)
+
+// requireAgentCerts is set when the listener verifies client certificates
+// (--tls-client-ca): agents must then prove their identity with a certificate
+// issued for their client_id. Monitors may connect without one.
+var requireAgentCerts bool
+
+// verifyAgentCertificate checks that the agent presented a verified client
+// certificate whose common name or DNS names match the announced client_id.
+func verifyAgentCertificate(conn net.Conn, clientID string) error {
+	if !requireAgentCerts {
+		return nil
+	}
+
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return fmt.Errorf("client certificate required but connection is not TLS")
+	}
+
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return fmt.Errorf("client certificate required")
+	}
+
+	leaf := state.VerifiedChains[0][0]
+	if leaf.Subject.CommonName == clientID || slices.Contains(leaf.DNSNames, clientID) {
+		return nil
+	}
+	return fmt.Errorf("certificate issued to %q does not match client_id %q", leaf.Subject.CommonName, clientID)
+}
@@ -0,0 +1,618 @@
+// Painel web: um monitor como o TUI de services/monitor, conectado via /ws.
+// Fala o mesmo protocolo (handshake, clients_request, client_update...), então
+// toda autorização fica a cargo do servidor.
+"use strict";
+
+// PROTOCOL_VERSION vem de version.js, gerado pelo servidor a partir de
+// protocol.ProtocolVersion.
+const HISTORY_CAPACITY = 60;
+const INTERVAL_STEP_MS = 1000;
+const MIN_INTERVAL_MS = 500;
+const MAX_INTERVAL_MS = 60000;
+
+const state = {
+  ws: null,
+  server: null,
+  clients: new Map(),
+  history: new Map(),
+  alerts: new Map(),
+  selected: "",
+  retryDelay: 1000,
+  authFailed: false,
+  messageSeq: 0,
+};
+
+// O token pode vir em ?token= (útil para links e telas fixas); ele é guardado
+// na sessão e removido da barra de endereço para não vazar em capturas.
+const params = new URLSearchParams(location.search);
+if (params.has("token")) {
+  sessionStorage.setItem("monitorToken", params.get("token"));
+  params.delete("token");
+  const query = params.toString();
+  history.replaceState(null, "", location.pathname + (query ? "?" + query : "") + location.hash);
+}
+const monitorName = params.get("name") || "painel-web";
+
+// el cria elementos sem interpretar HTML: IDs e nomes de processos vêm dos
+// agentes e não são confiáveis.
+function el(tag, attrs, ...children) {
+  const node = document.createElement(tag);
+  for (const [key, value] of Object.entries(attrs || {})) {
+    if (key === "class") node.className = value;
+    else if (key === "style") node.style.cssText = value;
+    else if (key.startsWith("on")) node.addEventListener(key.slice(2), value);
+    else node.setAttribute(key, value);
+  }
+  for (const child of children.flat()) {
+    if (child === null || child === undefined || child === false) continue;
+    node.append(child instanceof Node ? child : String(child));
+  }
+  return node;
+}
+
+// --- conexão -----------------------------------------------------------------
+
+function connect() {
+  const scheme = location.protocol === "https:" ? "wss" : "ws";
+  const ws = new WebSocket(`${scheme}://${location.host}/ws`);
+  state.ws = ws;
+  state.server = null;
+
+  ws.onopen = () => {
+    send("handshake", {
+      client_id: monitorName,
+      version: PROTOCOL_VERSION,
+      role: "monitor",
+      token: sessionStorage.getItem("monitorToken") || "",
+      features: ["history", "alerts", "heartbeat"],
+    });
+  };
+  ws.onmessage = (ev) => {
+    let msg;
+    try {
+      msg = JSON.parse(ev.data);
+    } catch (err) {
+      console.warn("mensagem inválida do servidor", err);
+      return;
+    }
+    handleMessage(msg);
+  };
+  ws.onclose = () => {
+    setConnection(false);
+    if (state.authFailed) return;
+    setStatus(`Conexão perdida; tentando novamente em ${Math.round(state.retryDelay / 1000)}s...`, "warning");
+    setTimeout(connect, state.retryDelay);
+    state.retryDelay = Math.min(state.retryDelay * 2, 30000);
+  };
+}
+
+function send(type, data, withID) {
+  if (!state.ws || state.ws.readyState !== WebSocket.OPEN) {
+    setStatus("Sem conexão com o servidor.", "error");
+    return false;
+  }
+  const msg = { type, data, ts: new Date().toISOString() };
+  if (withID) msg.id = `web-${Date.now().toString(36)}-${++state.messageSeq}`;
+  state.ws.send(JSON.stringify(msg));
+  return true;
+}
+
+function supports(feature) {
+  return !!(state.server && (state.server.features || []).includes(feature));
+}
+
+function handleMessage(msg) {
+  const data = msg.data || {};
+  switch (msg.type) {
+    case "handshake_ack":
+      state.server = data;
+      state.retryDelay = 1000;
+      setConnection(true);
+      setStatus(`Conectado (protocolo ${data.version}). Clique em um cliente para ver detalhes.`);
+      send("clients_request", {}, true);
+      break;
+    case "handshake_error":
+      state.authFailed = true;
+      setStatus(`Servidor recusou a conexão: ${data.reason}`, "error");
+      askToken();
+      break;
+    case "ping":
+      send("pong", data);
+      break;
+    case "clients_state":
+      applySnapshot(data.clients || []);
+      break;
+    case "client_update":
+      applyUpdate(data.client);
+      break;
+    case "client_removed":
+      applyRemoval(data.client_id);
+      setStatus(`Cliente ${data.client_id} desconectou.`);
+      break;
+    case "alerts_state":
+      state.alerts = new Map((data.alerts || []).map((a) => [a.id, a]));
+      renderAlerts();
+      break;
+    case "alert":
+      applyAlert(data);
+      break;
+    case "history_response":
+      applyHistory(data);
+      break;
+    case "error":
+      setStatus(`Servidor recusou ${data.ref_type || "mensagem"} (${data.code}): ${data.message}`, "error");
+      break;
+    case "server_shutdown":
+      setStatus(`Servidor encerrando (${data.reason}); reconectando quando voltar...`, "warning");
+      break;
+  }
+}
+
+function askToken() {
+  const dialog = document.getElementById("login");
+  dialog.querySelector("input").value = "";
+  dialog.onclose = () => {
+    const token = dialog.querySelector("input").value;
+    if (!token) return;
+    sessionStorage.setItem("monitorToken", token);
+    state.authFailed = false;
+    connect();
+  };
+  dialog.showModal();
+}
+
+// --- estado ------------------------------------------------------------------
+
+function clientKey(summary) {
+  return (summary.handshake && summary.handshake.client_id) || summary.remote_addr;
+}
+
+function ensureHistory(id) {
+  if (!state.history.has(id)) {
+    state.history.set(id, { cpu: [], memory: [], network: [], since: null, backfillRequested: false });
+  }
+  return state.history.get(id);
+}
+
+function pushValue(series, value) {
+  series.push(value);
+  if (series.length > HISTORY_CAPACITY) series.splice(0, series.length - HISTORY_CAPACITY);
+}
+
+// appendMetrics só acrescenta pontos quando a métrica mudou, pois o servidor
+// envia um client_update para cada mensagem recebida do agente.
+function appendMetrics(id, previous, summary) {
+  const h = ensureHistory(id);
+  if (!h.since && summary.last_update) h.since = new Date(summary.last_update);
+  if (summary.cpu && JSON.stringify(summary.cpu) !== JSON.stringify(previous && previous.cpu)) {
+    pushValue(h.cpu, summary.cpu.usage);
+  }
+  if (summary.memory && JSON.stringify(summary.memory) !== JSON.stringify(previous && previous.memory)) {
+    pushValue(h.memory, summary.memory.used_percent);
+  }
+  if (summary.network && JSON.stringify(summary.network) !== JSON.stringify(previous && previous.network)) {
+    pushValue(h.network, networkTotal(summary.network, (i) => i.bytes_in_per_sec + i.bytes_out_per_sec));
+  }
+}
+
+function applySnapshot(list) {
+  const next = new Map();
+  for (const summary of list) {
+    const id = clientKey(summary);
+    appendMetrics(id, state.clients.get(id), summary);
+    next.set(id, summary);
+  }
+  for (const id of state.history.keys()) {
+    if (!next.has(id)) state.history.delete(id);
+  }
+  state.clients = next;
+  if (!state.selected && next.size > 0) state.selected = sortedIDs()[0];
+  renderAll();
+  if (state.selected) requestBackfill(state.selected);
+}
+
+function applyUpdate(summary) {
+  if (!summary) return;
+  const id = clientKey(summary);
+  appendMetrics(id, state.clients.get(id), summary);
+  state.clients.set(id, summary);
+  if (!state.selected) state.selected = id;
+  renderList();
+  if (id === state.selected) renderDetails();
+}
+
+function applyRemoval(id) {
+  state.clients.delete(id);
+  state.history.delete(id);
+  if (state.selected === id) state.selected = sortedIDs()[0] || "";
+  renderAll();
+}
+
+function applyAlert(alert) {
+  if (alert.state === "resolved" || alert.state === "cancelled") {
+    state.alerts.delete(alert.id);
+  } else {
+    state.alerts.set(alert.id, alert);
+    if (alert.state === "firing" && !alert.acked_by) {
+      setStatus(`Alerta ${alert.rule} disparou em ${alert.client_id}: ${alert.message || ""}`, "warning");
+    }
+  }
+  renderAlerts();
+}
+
+// applyHistory antepõe os pontos do histórico às amostras recebidas ao vivo.
+function applyHistory(resp) {
+  if (resp.error) {
+    setStatus(`Histórico indisponível para ${resp.client_id}: ${resp.error}`, "warning");
+    return;
+  }
+  const h = state.history.get(resp.client_id);
+  if (!h) return;
+  const values = (resp.points || [])
+    .filter((p) => !h.since || new Date(p.timestamp) < h.since)
+    .map((p) => p.value);
+  const key = { cpu_usage: "cpu", memory_usage: "memory", network_usage: "network" }[resp.metric];
+  if (!key) return;
+  h[key] = values.concat(h[key]).slice(-HISTORY_CAPACITY);
+  if (resp.client_id === state.selected) renderDetails();
+}
+
+function requestBackfill(id) {
+  if (!supports("history")) return;
+  const client = state.clients.get(id);
+  const h = state.history.get(id);
+  if (!client || !h || h.backfillRequested || !h.since) return;
+  h.backfillRequested = true;
+
+  const stepMs = client.stats_interval_ms || 5000;
+  const from = new Date(h.since.getTime() - HISTORY_CAPACITY * stepMs);
+  for (const metric of ["cpu_usage", "memory_usage", "network_usage"]) {
+    send("history_request", {
+      client_id: id,
+      metric,
+      from: from.toISOString(),
+      to: h.since.toISOString(),
+      step_ms: stepMs,
+      aggregation: "avg",
+    }, true);
+  }
+}
+
+function sortedIDs() {
+  return [...state.clients.keys()].sort();
+}
+
+// --- renderização ------------------------------------------------------------
+
+function colorForUsage(value) {
+  if (value >= 90) return "#ff5555";
+  if (value >= 75) return "#ffb86c";
+  if (value >= 50) return "#f1fa8c";
+  if (value >= 25) return "#50fa7b";
+  return "#8be9fd";
+}
+
+function colorForSeverity(severity) {
+  if (severity === "critical") return "#ff5555";
+  if (severity === "warning") return "#ffb86c";
+  return "#8be9fd";
+}
+
+const HEALTH = {
+  healthy: ["#50fa7b", "●", "saudável"],
+  late: ["#ffb86c", "●", "atrasado"],
+  stale: ["#ff5555", "●", "sem resposta"],
+};
+
+function healthBadge(health) {
+  const [color, symbol, label] = HEALTH[health] || ["#6272a4", "○", "desconhecido"];
+  return { dot: el("span", { class: "dot", style: `color:${color}` }, symbol), label };
+}
+
+function humanBytes(v) {
+  const unit = 1024;
+  if (v < unit) return `${v}B`;
+  let exp = 0;
+  let value = v / unit;
+  while (value >= unit && exp < 5) {
+    value /= unit;
+    exp++;
+  }
+  return `${value.toFixed(2)}${"KMGTPE"[exp]}B`;
+}
+
+function humanRate(v) {
+  return `${humanBytes(Math.round(Math.max(0, v)))}/s`;
+}
+
+// networkTotal soma uma taxa de todas as interfaces; o histórico do servidor
+// usa entrada + saída (bytes_per_sec).
+function networkTotal(network, rate) {
+  return (network.interfaces || []).reduce((total, iface) => total + rate(iface), 0);
+}
+
+function elapsed(since) {
+  if (!since) return "n/d";
+  const seconds = Math.max(0, Math.round((Date.now() - new Date(since).getTime()) / 1000));
+  if (seconds < 60) return `${seconds}s`;
+  if (seconds < 3600) return `${Math.floor(seconds / 60)}m${seconds % 60}s`;
+  return `${Math.floor(seconds / 3600)}h${Math.floor((seconds % 3600) / 60)}m`;
+}
+
+// uptime descreve há quanto tempo a máquina está ligada, como no TUI.
+function uptime(boot) {
+  const minutes = Math.max(0, Math.floor((Date.now() - new Date(boot).getTime()) / 60000));
+  const days = Math.floor(minutes / 1440);
+  const hours = Math.floor((minutes % 1440) / 60);
+  if (days > 0) return `${days}d${hours}h`;
+  if (hours > 0) return `${hours}h${minutes % 60}m`;
+  return `${minutes}m`;
+}
+
+// hostSummary mostra hostname e tempo ligado quando o agente os envia,
+// senão o endereço remoto.
+function hostSummary(client) {
+  const g = client.general;
+  if (!g || !g.hostname) return client.remote_addr;
+  return g.boot_time ? `${g.hostname} | ligado há ${uptime(g.boot_time)}` : g.hostname;
+}
+
+function bar(label, value, detail) {
+  const pct = Math.max(0, Math.min(100, value || 0));
+  return el("div", { class: "bar-row" },
+    el("span", { class: "label" }, label),
+    el("div", { class: "bar" }, el("span", { style: `width:${pct}%;background:${colorForUsage(pct)}` })),
+    el("span", null, detail));
+}
+
+// heatmap desenha a série (em %) como colunas de blocos coloridos, como no TUI.
+function heatmap(title, values) {
+  const rows = 8;
+  const cell = 7;
+  const canvas = el("canvas", { width: HISTORY_CAPACITY * cell, height: rows * cell });
+  const ctx = canvas.getContext("2d");
+  const padded = Array(Math.max(0, HISTORY_CAPACITY - values.length)).fill(null).concat(values.slice(-HISTORY_CAPACITY));
+  padded.forEach((v, col) => {
+    if (v === null) return;
+    const filled = Math.max(0, Math.min(rows - 1, Math.round((v / 100) * (rows - 1))));
+    ctx.fillStyle = colorForUsage(v);
+    for (let row = 0; row <= filled; row++) {
+      ctx.fillRect(col * cell + 1, (rows - 1 - row) * cell + 1, cell - 2, cell - 2);
+    }
+  });
+  return el("div", null, el("div", { class: "label" }, title), canvas);
+}
+
+function renderAll() {
+  renderList();
+  renderDetails();
+  renderAlerts();
+}
+
+function renderList() {
+  const list = document.getElementById("clients");
+  list.replaceChildren();
+  const ids = sortedIDs();
+  if (ids.length === 0) {
+    list.append(el("li", { class: "muted" }, "Nenhum cliente conectado."));
+    return;
+  }
+  for (const id of ids) {
+    const client = state.clients.get(id);
+    const badge = healthBadge(client.health);
+    list.append(el("li", {
+      class: id === state.selected ? "selected" : "",
+      onclick: () => selectClient(id),
+    },
+    el("div", null, badge.dot, id),
+    el("div", { class: "secondary" }, `${hostSummary(client)} | Atualizado há ${elapsed(client.last_update)} | ${badge.label}`)));
+  }
+}
+
+function selectClient(id) {
+  state.selected = id;
+  renderList();
+  renderDetails();
+  requestBackfill(id);
+}
+
+function renderDetails() {
+  const panel = document.getElementById("details");
+  const client = state.clients.get(state.selected);
+  if (!client) {
+    panel.replaceChildren(el("p", { class: "muted" },
+      state.clients.size ? "Selecione um cliente para ver detalhes." : "Nenhum cliente conectado. Aguardando dados..."));
+    return;
+  }
+
+  const id = state.selected;
+  const h = ensureHistory(id);
+  const badge = healthBadge(client.health);
+  const parts = [el("h2", null, badge.dot, id)];
+
+  const info = [`Endereço: ${client.remote_addr}`];
+  if (client.handshake && client.handshake.version) info.push(`Versão: ${client.handshake.version}`);
+  info.push(`Saúde: ${badge.label}`);
+  info.push(`Atualizado há ${elapsed(client.last_update)}`);
+  parts.push(el("p", { class: "muted" }, info.join(" | ")));
+
+  if (client.general) {
+    const g = client.general;
+    if (g.hostname) {
+      const host = [g.hostname, `${g.platform} ${g.platform_version}`, `kernel ${g.kernel_version} (${g.kernel_arch})`];
+      if (g.boot_time) host.push(`ligado há ${uptime(g.boot_time)}`);
+      parts.push(el("p", null, el("span", { class: "label" }, "Host: "), host.join(" | ")));
+    }
+    const cores = g.logical_cores ? `${g.logical_cores} núcleos lógicos, ${g.physical_cores} físicos` : `${g.cores} núcleos`;
+    parts.push(el("p", null, el("span", { class: "label" }, "CPU: "), `${g.model_name} (${cores} @ ${g.mhz.toFixed(2)} MHz)`));
+  }
+  if (client.load) {
+    const l = client.load;
+    parts.push(el("p", null, el("span", { class: "label" }, "Carga: "),
+      `${l.load1.toFixed(2)} ${l.load5.toFixed(2)} ${l.load15.toFixed(2)} (1/5/15 min) | Trocas de contexto: ${Math.round(l.context_switches_per_sec)}/s | Processos: ${l.procs_running} executando, ${l.procs_blocked} bloqueados`));
+  }
+
+  if (client.cpu) parts.push(bar("CPU", client.cpu.usage, `${client.cpu.usage.toFixed(1)}%`));
+  if (client.memory) {
+    const m = client.memory;
+    parts.push(bar("Memória", m.used_percent, `${m.used_percent.toFixed(1)}% (${humanBytes(m.used)} / ${humanBytes(m.total)})`));
+  }
+  if (client.load && client.load.swap_total) {
+    const l = client.load;
+    parts.push(bar("Swap", l.swap_used_percent, `${l.swap_used_percent.toFixed(1)}% (${humanBytes(l.swap_used)} / ${humanBytes(l.swap_total)})`));
+  }
+  if (client.disk && !(client.disk.mounts || []).length) {
+    const d = client.disk;
+    parts.push(bar("Disco", d.used_percent, `${d.used_percent.toFixed(1)}% (${humanBytes(d.used)} / ${humanBytes(d.total)})`));
+  }
+
+  if (client.disk && (client.disk.mounts || []).length) {
+    parts.push(el("h3", null, "Discos"));
+    parts.push(el("div", { class: "mounts" }, client.disk.mounts.map((m) => bar(m.mountpoint, m.used_percent,
+      `${m.used_percent.toFixed(1)}% (${humanBytes(m.used)} / ${humanBytes(m.total)}) | inodes ${m.inodes_used_percent.toFixed(1)}% | ${m.fstype}`))));
+  }
+  if (client.disk_io && (client.disk_io.devices || []).length) {
+    parts.push(el("h3", null, "E/S de disco"));
+    parts.push(el("table", null,
+      el("thead", null, el("tr", null, el("th", null, "Dispositivo"), el("th", null, "Leitura"), el("th", null, "Escrita"), el("th", null, "Ocupado"))),
+      el("tbody", null, client.disk_io.devices.map((d) => el("tr", null,
+        el("td", null, d.name),
+        el("td", { class: "num" }, `${humanRate(d.read_bytes_per_sec)} (${d.reads_per_sec.toFixed(0)} op/s)`),
+        el("td", { class: "num" }, `${humanRate(d.write_bytes_per_sec)} (${d.writes_per_sec.toFixed(0)} op/s)`),
+        el("td", { class: "num", style: `color:${colorForUsage(d.busy_percent)}` }, `${d.busy_percent.toFixed(1)}%`))))));
+  }
+
+  if (client.cpu && (client.cpu.cores_usage || []).length) {
+    parts.push(el("h3", null, "Uso por núcleo"));
+    parts.push(el("div", { class: "cores" },
+      client.cpu.cores_usage.map((v, i) => bar(`#${i}`, v, `${v.toFixed(1)}%`))));
+  }
+
+  parts.push(el("h3", null, "Histórico"));
+  parts.push(el("div", { class: "heatmaps" },
+    heatmap(`CPU (${lastValue(h.cpu)})`, h.cpu),
+    heatmap(`Memória (${lastValue(h.memory)})`, h.memory)));
+
+  if (client.network) {
+    parts.push(networkSection(client.network, h.network));
+  }
+
+  parts.push(el("h3", null, "Intervalo de envio"));
+  parts.push(intervalControls(id, client));
+
+  if (client.sequence) {
+    const seq = client.sequence;
+    const color = seq.missing || seq.duplicates ? "#ff5555" : "#50fa7b";
+    parts.push(el("p", null, el("span", { class: "label" }, "Mensagens: "),
+      `${seq.received} recebidas | `,
+      el("span", { style: `color:${color}` }, `${seq.missing} perdidas, ${seq.duplicates} duplicadas`),
+      ` (seq ${seq.last_seq})`));
+  }
+
+  const procs = ((client.processes && client.processes.processes) || []).slice().sort((a, b) => b.cpu_percent - a.cpu_percent).slice(0, 5);
+  if (procs.length) {
+    parts.push(el("h3", null, `Processos (top ${procs.length})`));
+    parts.push(el("table", null,
+      el("thead", null, el("tr", null, el("th", null, "PID"), el("th", null, "Nome"), el("th", null, "CPU"), el("th", null, "Memória"))),
+      el("tbody", null, procs.map((p) => el("tr", null,
+        el("td", null, p.pid),
+        el("td", null, p.name),
+        el("td", { class: "num" }, `${p.cpu_percent.toFixed(2)}%`),
+        el("td", { class: "num" }, `${p.memory_mb.toFixed(2)} MB`))))));
+  }
+
+  panel.replaceChildren(...parts);
+}
+
+function lastValue(values) {
+  return values.length ? `${values[values.length - 1].toFixed(1)}%` : "sem dados";
+}
+
+// networkSection mostra as taxas por interface e o tráfego total; o heatmap
+// usa porcentagens do pico da série, já que bytes/s não têm limite fixo.
+function networkSection(network, series) {
+  const peak = Math.max(0, ...series);
+  const scaled = series.map((v) => (peak > 0 ? (v / peak) * 100 : 0));
+  const rows = (network.interfaces || []).map((i) => {
+    const errorRate = i.errors_in_per_sec + i.errors_out_per_sec;
+    const dropRate = i.drops_in_per_sec + i.drops_out_per_sec;
+    const color = errorRate > 0 || dropRate > 0 ? "#ff5555" : "#50fa7b";
+    return el("tr", null,
+      el("td", null, i.name),
+      el("td", { class: "num" }, humanRate(i.bytes_in_per_sec)),
+      el("td", { class: "num" }, humanRate(i.bytes_out_per_sec)),
+      el("td", { class: "num" }, `${i.packets_in_per_sec.toFixed(0)}/s ↓ ${i.packets_out_per_sec.toFixed(0)}/s ↑`),
+      el("td", { class: "num", style: `color:${color}` }, `${errorRate.toFixed(1)}/s | ${dropRate.toFixed(1)}/s`));
+  });
+  return el("div", null,
+    el("h3", null, `Rede (↓ ${humanRate(networkTotal(network, (i) => i.bytes_in_per_sec))} ↑ ${humanRate(networkTotal(network, (i) => i.bytes_out_per_sec))})`),
+    el("div", { class: "heatmaps" }, heatmap(`Tráfego (pico ${humanRate(peak)})`, scaled)),
+    el("table", null,
+      el("thead", null, el("tr", null, el("th", null, "Interface"), el("th", null, "Entrada"), el("th", null, "Saída"),
+        el("th", null, "Pacotes"), el("th", null, "Erros | descartes"))),
+      el("tbody", null, rows)));
+}
+
+function intervalControls(id, client) {
+  const current = client.stats_interval_ms || 5000;
+  const input = el("input", { type: "number", min: MIN_INTERVAL_MS, max: MAX_INTERVAL_MS, step: 100, value: current });
+  return el("div", { class: "interval" },
+    el("button", { title: "Diminuir (mais frequente)", onclick: () => changeInterval(id, current - INTERVAL_STEP_MS) }, "−"),
+    el("span", null, `${current} ms`),
+    el("button", { title: "Aumentar (menos frequente)", onclick: () => changeInterval(id, current + INTERVAL_STEP_MS) }, "+"),
+    input,
+    el("button", { onclick: () => changeInterval(id, Number(input.value)) }, "Aplicar"));
+}
+
+function changeInterval(id, value) {
+  if (!Number.isFinite(value)) return;
+  const clamped = Math.max(MIN_INTERVAL_MS, Math.min(MAX_INTERVAL_MS, Math.round(value)));
+  if (send("interval_set_request", { client_id: id, interval_ms: clamped }, true)) {
+    setStatus(`Solicitado novo intervalo (${clamped} ms) para ${id}`);
+  }
+}
+
+function renderAlerts() {
+  const list = document.getElementById("alerts");
+  list.replaceChildren();
+  if (state.server && !supports("alerts")) {
+    list.append(el("li", { class: "muted" }, "Não suportado pelo servidor."));
+    return;
+  }
+  const alerts = [...state.alerts.values()].sort((a, b) => a.client_id.localeCompare(b.client_id) || a.rule.localeCompare(b.rule));
+  if (alerts.length === 0) {
+    list.append(el("li", { class: "muted" }, "Nenhum alerta ativo."));
+    return;
+  }
+  for (const alert of alerts) {
+    const acked = alert.acked_by ? ` | reconhecido por ${alert.acked_by}` : "";
+    list.append(el("li", { onclick: () => selectClient(alert.client_id) },
+      el("div", null,
+        el("span", { style: `color:${colorForSeverity(alert.severity)}` }, `[${alert.state}] `),
+        `${alert.rule} em ${alert.client_id}`),
+      el("div", { class: "secondary" }, `${alert.metric}.${alert.field} = ${alert.value.toFixed(1)} (${alert.operator} ${alert.threshold})${acked}`),
+      !alert.acked_by && el("button", {
+        onclick: (ev) => {
+          ev.stopPropagation();
+          send("alert_ack", { alert_id: alert.id }, true);
+        },
+      }, "Reconhecer")));
+  }
+}
+
+function setConnection(online) {
+  const badge = document.getElementById("connection");
+  badge.textContent = online ? `Conectado (${state.server.version})` : "Desconectado";
+  badge.className = `badge ${online ? "online" : "offline"}`;
+}
+
+function setStatus(text, level) {
+  const footer = document.getElementById("status");
+  footer.textContent = text;
+  footer.className = level || "";
+}
+
+// A lista mostra há quanto tempo cada cliente atualizou; sem isso ela só
+// mudaria com a chegada de mensagens.
+setInterval(renderList, 1000);
+connect();
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket opcodes and limits (RFC 6455).
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+
+	wsMaxMessage = 1 << 20
+	wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// wsCloseTimeout bounds the closure frame sent by Close; the socket is
+	// closed when it expires even if the peer took nothing.
+	wsCloseTimeout = 250 * time.Millisecond
+)
+
+var errWSProtocol = errors.New("websocket protocol error")
+
+// wsAllowedOrigins lists the origins (scheme://host[:port]) besides the
+// server's own that browsers may open /ws from (--ws-allowed-origins).
+var wsAllowedOrigins []string
+
+// originAllowed protects /ws from cross-site WebSocket hijacking: a page on
+// another site could otherwise drive a monitor session with the operator's
+// network access, which is admin when authentication is disabled. Requests
+// without Origin come from non-browser tools and are allowed.
+func originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range wsAllowedOrigins {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// handleWebSocket upgrades the request and serves it like a TCP connection:
+// every text message carries one protocol.Message and the peer goes through
+// the usual handshake, so browser monitors share the monitor registry,
+// authentication and handlers with the TUI.
+func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected a WebSocket upgrade", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return
+	}
+	if !originAllowed(r) {
+		fmt.Printf("🚫 Refusing WebSocket from %s: origin %s not allowed\n", r.RemoteAddr, r.Header.Get("Origin"))
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return
+	}
+	if !trackConnection() {
+		http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		fmt.Println("❌ Error upgrading to WebSocket:", err)
+		connWG.Done()
+		return
+	}
+	// Drop the deadlines left by the HTTP server; handleConnection sets its own.
+	conn.SetDeadline(time.Time{})
+
+	sum := sha1.Sum([]byte(key + wsAcceptGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		connWG.Done()
+		return
+	}
+
+	fmt.Println("🔌 WebSocket connection from", conn.RemoteAddr())
+	serveConnection(&wsConn{Conn: conn, reader: rw.Reader})
+}
+
+// headerHasToken reports whether a comma separated header contains token.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsConn adapts a WebSocket to the newline delimited stream handleConnection
+// reads: each incoming text message becomes a line, and each Write (one
+// encoded message) is sent as a text frame. Deadlines and addresses come from
+// the underlying connection.
+type wsConn struct {
+	net.Conn
+	reader  *bufio.Reader
+	pending []byte
+
+	writeMu   sync.Mutex
+	closeOnce sync.Once
+}
+
+// Read returns the next message followed by a newline.
+func (c *wsConn) Read(p []byte) (int, error) {
+	if len(c.pending) == 0 {
+		msg, err := c.nextMessage()
+		if err != nil {
+			return 0, err
+		}
+		c.pending = append(msg, '\n')
+	}
+
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write sends one encoded protocol message as a text frame.
+func (c *wsConn) Write(p []byte) (int, error) {
+	payload := p
+	if len(payload) > 0 && payload[len(payload)-1] == '\n' {
+		payload = payload[:len(payload)-1]
+	}
+	if err := c.writeFrame(wsOpText, payload); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the socket without waiting on writers: MonitorConn closes a
+// lagging monitor while holding its lock, and that monitor's writer may be
+// stuck in writeFrame. The normal closure frame is only sent, in the
+// background and bounded by wsCloseTimeout, when no other write is in flight.
+func (c *wsConn) Close() error {
+	err := net.ErrClosed
+	c.closeOnce.Do(func() {
+		if !c.writeMu.TryLock() {
+			err = c.Conn.Close()
+			return
+		}
+		err = nil
+		go func() {
+			defer c.writeMu.Unlock()
+			// Writers set their own deadlines, so a timer closes the socket
+			// even if one of them extends the deadline set here.
+			timer := time.AfterFunc(wsCloseTimeout, func() { c.Conn.Close() })
+			defer timer.Stop()
+			c.Conn.SetWriteDeadline(time.Now().Add(wsCloseTimeout))
+			c.Conn.Write(wsFrame(wsOpClose, []byte{0x03, 0xE8}))
+			c.Conn.Close()
+		}()
+	})
+	return err
+}
+
+// nextMessage reads frames until a complete text message arrives, answering
+// pings and closes along the way.
+func (c *wsConn) nextMessage() ([]byte, error) {
+	var (
+		msg     []byte
+		started bool
+	)
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			return nil, io.EOF
+		case wsOpText:
+			if started {
+				return nil, fmt.Errorf("%w: text frame inside a fragmented message", errWSProtocol)
+			}
+			msg, started = payload, true
+		case wsOpContinuation:
+			if !started {
+				return nil, fmt.Errorf("%w: unexpected continuation frame", errWSProtocol)
+			}
+			msg = append(msg, payload...)
+		case wsOpBinary:
+			return nil, fmt.Errorf("%w: binary messages are not supported", errWSProtocol)
+		default:
+			return nil, fmt.Errorf("%w: unknown opcode %#x", errWSProtocol, opcode)
+		}
+
+		if len(msg) > wsMaxMessage {
+			return nil, fmt.Errorf("%w: message larger than %d bytes", errWSProtocol, wsMaxMessage)
+		}
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+// readFrame reads and unmasks one frame. Frames from browsers are always
+// masked; anything else is rejected.
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.reader, head[:]); err != nil {
+		return
+	}
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0F
+	if head[0]&0x70 != 0 {
+		return fin, opcode, nil, fmt.Errorf("%w: reserved bits set", errWSProtocol)
+	}
+	if head[1]&0x80 == 0 {
+		return fin, opcode, nil, fmt.Errorf("%w: unmasked client frame", errWSProtocol)
+	}
+
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.reader, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.reader, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if opcode >= wsOpClose && (length > 125 || !fin) {
+		return fin, opcode, nil, fmt.Errorf("%w: invalid control frame", errWSProtocol)
+	}
+	if length > wsMaxMessage {
+		return fin, opcode, nil, fmt.Errorf("%w: frame larger than %d bytes", errWSProtocol, wsMaxMessage)
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.reader, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.reader, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// writeFrame sends an unmasked, unfragmented frame.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame := wsFrame(opcode, payload)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.Conn.Write(frame)
+	return err
+}
+
+// wsFrame encodes an unmasked, unfragmented frame.
+func wsFrame(opcode byte, payload []byte) []byte {
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode
+	switch n := len(payload); {
+	case n <= 125:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	return append(header, payload...)
+}
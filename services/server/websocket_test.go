@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	defer func(saved []string) { wsAllowedOrigins = saved }(wsAllowedOrigins)
+	wsAllowedOrigins = []string{"https://painel.example.com"}
+
+	tests := []struct {
+		name, host, origin string
+		want               bool
+	}{
+		{"no origin (non-browser)", "localhost:8081", "", true},
+		{"same host", "localhost:8081", "http://localhost:8081", true},
+		{"same host, other case", "LocalHost:8081", "http://localhost:8081", true},
+		{"same host over https", "monitor.lan:8443", "https://monitor.lan:8443", true},
+		{"other site", "localhost:8081", "https://evil.example", false},
+		{"same name, other port", "localhost:8081", "http://localhost:3000", false},
+		{"configured origin", "localhost:8081", "https://painel.example.com", true},
+		{"configured origin, other scheme", "localhost:8081", "http://painel.example.com", false},
+		{"opaque origin", "localhost:8081", "null", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "http://"+tt.host+"/ws", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := originAllowed(r); got != tt.want {
+				t.Fatalf("originAllowed(host %s, origin %q) = %v, want %v", tt.host, tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLaggingWebSocketMonitorIsDroppedPromptly(t *testing.T) {
+	// Nobody reads the browser side, so the monitor's writer blocks in
+	// writeFrame, holding the frame lock until its write deadline.
+	server, peer := net.Pipe()
+	defer peer.Close()
+	ws := &wsConn{Conn: server, reader: bufio.NewReader(server)}
+	defer ws.Close()
+
+	mon := &MonitorConn{
+		remote:  "ws-monitor-test",
+		id:      "ws-monitor-test",
+		conn:    ws,
+		updates: make(map[string]int),
+		wake:    make(chan struct{}, 1),
+	}
+	go mon.writeLoop()
+
+	mon.send(clientUpdate("first", 0))
+	for deadline := time.Now().Add(time.Second); ; {
+		mon.mu.Lock()
+		taken := len(mon.queue) == 0
+		mon.mu.Unlock()
+		if taken {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("writer never picked up the first message")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 0; i < monitorQueueSize; i++ {
+		if err := mon.send(clientUpdate(fmt.Sprintf("client-%d", i), 0)); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+	}
+
+	start := time.Now()
+	if err := mon.send(clientUpdate("one-too-many", 0)); !errors.Is(err, errMonitorLagging) {
+		t.Fatalf("overflow error = %v, want errMonitorLagging", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("dropping a stalled WebSocket monitor blocked send for %s", elapsed)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// main generates a local CA plus the server and agent certificates used to
+// test TLS between the services. The output is meant for development only.
+func main() {
+	outDir := flag.String("out", "certs", "Directory where the PEM files are written")
+	hosts := flag.String("hosts", "localhost,127.0.0.1,::1", "Comma-separated DNS names/IPs for the server certificate")
+	clients := flag.String("clients", "client", "Comma-separated client IDs to issue agent certificates for")
+	monitors := flag.String("monitors", "", "Comma-separated monitor names to issue certificates for (optional)")
+	days := flag.Int("days", 365, "Validity of the generated certificates in days")
+	flag.Parse()
+
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		fail(err)
+	}
+	validity := time.Duration(*days) * 24 * time.Hour
+
+	ca, caKey, err := createCA(*outDir, validity)
+	if err != nil {
+		fail(err)
+	}
+	fmt.Printf("🔐 CA written to %s\n", filepath.Join(*outDir, "ca.pem"))
+
+	serverTemplate := leafTemplate("server", validity, x509.ExtKeyUsageServerAuth)
+	for _, host := range splitList(*hosts) {
+		if ip := net.ParseIP(host); ip != nil {
+			serverTemplate.IPAddresses = append(serverTemplate.IPAddresses, ip)
+		} else {
+			serverTemplate.DNSNames = append(serverTemplate.DNSNames, host)
+		}
+	}
+	if err := issue(*outDir, "server", serverTemplate, ca, caKey); err != nil {
+		fail(err)
+	}
+	fmt.Printf("🖥️  Server certificate for %s\n", *hosts)
+
+	for _, id := range append(splitList(*clients), splitList(*monitors)...) {
+		template := leafTemplate(id, validity, x509.ExtKeyUsageClientAuth)
+		template.DNSNames = []string{id}
+		if err := issue(*outDir, id, template, ca, caKey); err != nil {
+			fail(err)
+		}
+		fmt.Printf("🪪 Certificate for %s\n", id)
+	}
+}
+
+// createCA generates a self-signed CA and writes ca.pem and ca-key.pem.
+func createCA(dir string, validity time.Duration) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber(),
+		Subject:               pkix.Name{CommonName: "ACH2026 local CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := writePEM(filepath.Join(dir, "ca.pem"), "CERTIFICATE", der, 0o644); err != nil {
+		return nil, nil, err
+	}
+	if err := writeKey(filepath.Join(dir, "ca-key.pem"), key); err != nil {
+		return nil, nil, err
+	}
+	return cert, key, nil
+}
+
+// leafTemplate returns the common fields of a certificate signed by the CA.
+func leafTemplate(name string, validity time.Duration, usage x509.ExtKeyUsage) *x509.Certificate {
+	return &x509.Certificate{
+		SerialNumber: serialNumber(),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+}
+
+// issue signs the template with the CA and writes <name>.pem and <name>-key.pem.
+func issue(dir, name string, template, ca *x509.Certificate, caKey *ecdsa.PrivateKey) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return fmt.Errorf("sign %s: %w", name, err)
+	}
+	if err := writePEM(filepath.Join(dir, name+".pem"), "CERTIFICATE", der, 0o644); err != nil {
+		return err
+	}
+	return writeKey(filepath.Join(dir, name+"-key.pem"), key)
+}
+
+func writeKey(path string, key *ecdsa.PrivateKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return writePEM(path, "PRIVATE KEY", der, 0o600)
+}
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), perm)
+}
+
+func serialNumber() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		fail(err)
+	}
+	return serial
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+	os.Exit(1)
+}